@@ -0,0 +1,617 @@
+package gserv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log formats, anything else passed as AccessLogOptions.Format is parsed as a template.
+//
+// Templates support the Apache mod_log_config directives:
+//
+//	%h client ip, %l always "-", %u basic auth user, %t time, %r request line,
+//	%s or %>s status, %b bytes written or "-", %B bytes written, %D duration in microseconds, %T duration in seconds,
+//	%m method, %U path, %q query string (with the ?), %H protocol, %L request id (see RequestID),
+//	%{Name}i request header, %{Name}o response header, %%
+//
+// and the gserv specific %{route}x, %{group}x and %{body}x (see AccessLogOptions.MaxBodySize).
+// Like Apache, quotes, backslashes and control characters in the values are escaped, ex: \" or \x1b.
+const (
+	AccessLogCommon   = `%h %l %u %t "%r" %>s %b`
+	AccessLogCombined = AccessLogCommon + ` "%{Referer}i" "%{User-Agent}i"`
+	AccessLogJSON     = "json"
+	AccessLogLogfmt   = "logfmt"
+)
+
+var (
+	// DefaultRedactHeaders are the request and response headers redacted by AccessLog if AccessLogOptions.RedactHeaders is nil.
+	DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+	// DefaultRedactFields are the body fields and query params redacted by AccessLog if AccessLogOptions.RedactFields is nil.
+	DefaultRedactFields = []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "api_key"}
+)
+
+const redacted = "[REDACTED]"
+
+// AccessLogOptions controls the output of AccessLog.
+type AccessLogOptions struct {
+	// Format is one of AccessLogCommon, AccessLogCombined, AccessLogJSON, AccessLogLogfmt or a template,
+	// defaults to AccessLogCombined.
+	Format string
+
+	// Headers are the request headers included in json and logfmt lines.
+	Headers []string
+
+	// MaxBodySize is the max number of bytes of the request body that's logged, 0 disables body logging.
+	// Only the logged part of the body is kept in memory, multipart bodies are never logged since their fields can't be redacted.
+	MaxBodySize int
+
+	// RedactHeaders are replaced with [REDACTED], matched case-insensitively, defaults to DefaultRedactHeaders.
+	RedactHeaders []string
+
+	// RedactFields are the JSON (including +json types) and form body fields and query params replaced with [REDACTED], matched case-insensitively,
+	// defaults to DefaultRedactFields.
+	RedactFields []string
+}
+
+// AccessLog returns a middleware that writes a line per request to w, see AccessLogOptions.
+// w is written to from multiple goroutines, see NewAsyncWriter and OpenLogFile.
+// It panics if opts.Format is an invalid template.
+func AccessLog(w io.Writer, opts *AccessLogOptions) Handler {
+	var o AccessLogOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Format == "" {
+		o.Format = AccessLogCombined
+	}
+	if o.RedactHeaders == nil {
+		o.RedactHeaders = DefaultRedactHeaders
+	}
+	if o.RedactFields == nil {
+		o.RedactFields = DefaultRedactFields
+	}
+
+	al := &accessLog{w: w, opts: &o}
+	switch o.Format {
+	case AccessLogJSON, AccessLogLogfmt:
+	default:
+		parts, err := parseAccessLogFormat(o.Format)
+		if err != nil {
+			panic(err)
+		}
+		al.parts = parts
+	}
+
+	return al.handle
+}
+
+type accessLog struct {
+	w     io.Writer
+	opts  *AccessLogOptions
+	parts []accessLogPart
+}
+
+type accessLogEntry struct {
+	ctx       *Context
+	al        *accessLog
+	start     time.Time
+	dur       time.Duration
+	body      []byte
+	truncated bool
+}
+
+type accessLogPart func(b []byte, e *accessLogEntry) []byte
+
+var accessLogBufPool = sync.Pool{
+	New: func() any { return new([]byte) },
+}
+
+func (al *accessLog) handle(ctx *Context) Response {
+	e := accessLogEntry{ctx: ctx, al: al, start: time.Now()}
+
+	if n := al.opts.MaxBodySize; n > 0 && ctx.Req.Body != nil && ctx.Req.Body != http.NoBody &&
+		!strings.HasPrefix(ctx.ContentType(), "multipart/") {
+		e.body, e.truncated = peekBody(ctx.Req, n)
+	}
+
+	ctx.NextMiddleware()
+	ctx.Next()
+
+	e.dur = time.Since(e.start)
+
+	bp := accessLogBufPool.Get().(*[]byte)
+	b := (*bp)[:0]
+	switch al.opts.Format {
+	case AccessLogJSON:
+		b = e.appendJSON(b)
+	case AccessLogLogfmt:
+		b = e.appendLogfmt(b)
+	default:
+		for _, p := range al.parts {
+			b = p(b, &e)
+		}
+	}
+	b = append(b, '\n')
+	al.w.Write(b)
+	*bp = b
+	accessLogBufPool.Put(bp)
+	return nil
+}
+
+// peekBody reads up to n bytes of the body and puts them back in front of the rest of it.
+func peekBody(req *http.Request, n int) (body []byte, truncated bool) {
+	read, _ := io.ReadAll(io.LimitReader(req.Body, int64(n)+1))
+	req.Body = &peekedBody{io.MultiReader(bytes.NewReader(read), req.Body), req.Body}
+	if len(read) > n {
+		return read[:n:n], true
+	}
+	return read, false
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func (e *accessLogEntry) status() int { return e.ctx.Status() }
+
+func (e *accessLogEntry) header(name string) string {
+	v := e.ctx.Req.Header.Get(name)
+	if v != "" && e.al.redactHeader(name) {
+		return redacted
+	}
+	return v
+}
+
+func (e *accessLogEntry) respHeader(name string) string {
+	v := e.ctx.Header().Get(name)
+	if v != "" && e.al.redactHeader(name) {
+		return redacted
+	}
+	return v
+}
+
+// query returns the request's raw query with the values of RedactFields replaced.
+func (e *accessLogEntry) query() string {
+	q := e.ctx.Req.URL.RawQuery
+	if q == "" {
+		return ""
+	}
+	return string(redactForm([]byte(q), e.al.opts.RedactFields))
+}
+
+// requestURI is req.URL.RequestURI() with the query redacted.
+func (e *accessLogEntry) requestURI() string {
+	u := *e.ctx.Req.URL
+	u.RawQuery = e.query()
+	return u.RequestURI()
+}
+
+func (al *accessLog) redactHeader(name string) bool {
+	for _, h := range al.opts.RedactHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *accessLogEntry) route() string {
+	if rn := e.ctx.Route(); rn != nil {
+		return rn.Path()
+	}
+	return ""
+}
+
+func (e *accessLogEntry) group() string {
+	if rn := e.ctx.Route(); rn != nil {
+		return rn.Group()
+	}
+	return ""
+}
+
+func (e *accessLogEntry) user() string {
+	u, _, _ := e.ctx.Req.BasicAuth()
+	return u
+}
+
+// loggedBody returns the redacted body, with "..." appended if it was truncated.
+func (e *accessLogEntry) loggedBody() string {
+	if len(e.body) == 0 {
+		return ""
+	}
+
+	fields := e.al.opts.RedactFields
+	ct, _, _ := mime.ParseMediaType(e.ctx.ContentType())
+	var b []byte
+	switch {
+	case ct == MimeJSON, strings.HasSuffix(ct, "+json"), ct == "" && (e.body[0] == '{' || e.body[0] == '['):
+		b = redactJSON(e.body, fields)
+	case ct == MimeForm:
+		b = redactForm(e.body, fields)
+	default:
+		b = e.body
+	}
+
+	if e.truncated {
+		b = append(b, "..."...)
+	}
+	return string(b)
+}
+
+func (e *accessLogEntry) appendJSON(b []byte) []byte {
+	req := e.ctx.Req
+	b = append(b, '{')
+	b = appendJSONField(b, "time", e.start.Format(time.RFC3339Nano), true)
+	if id := e.ctx.reqID; id != "" {
+		b = appendJSONField(b, "requestID", id, false)
+	}
+	b = appendJSONField(b, "clientIP", e.ctx.ClientIP(), false)
+	if u := e.user(); u != "" {
+		b = appendJSONField(b, "user", u, false)
+	}
+	b = appendJSONField(b, "method", req.Method, false)
+	b = appendJSONField(b, "path", req.URL.Path, false)
+	if q := e.query(); q != "" {
+		b = appendJSONField(b, "query", q, false)
+	}
+	b = appendJSONField(b, "proto", req.Proto, false)
+	if r := e.route(); r != "" {
+		b = appendJSONField(b, "route", r, false)
+	}
+	b = append(b, `,"status":`...)
+	b = strconv.AppendInt(b, int64(e.status()), 10)
+	b = append(b, `,"bytes":`...)
+	b = strconv.AppendInt(b, int64(e.ctx.BytesWritten()), 10)
+	b = append(b, `,"duration":`...)
+	b = strconv.AppendFloat(b, e.dur.Seconds(), 'f', -1, 64)
+	if v := req.Referer(); v != "" {
+		b = appendJSONField(b, "referer", v, false)
+	}
+	if v := req.UserAgent(); v != "" {
+		b = appendJSONField(b, "userAgent", v, false)
+	}
+	for _, h := range e.al.opts.Headers {
+		if v := e.header(h); v != "" {
+			b = appendJSONField(b, http.CanonicalHeaderKey(h), v, false)
+		}
+	}
+	if body := e.loggedBody(); body != "" {
+		b = appendJSONField(b, "body", body, false)
+	}
+	return append(b, '}')
+}
+
+func appendJSONField(b []byte, k, v string, first bool) []byte {
+	if !first {
+		b = append(b, ',')
+	}
+	b = appendJSONString(b, k)
+	b = append(b, ':')
+	return appendJSONString(b, v)
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	j, _ := json.Marshal(s)
+	return append(b, j...)
+}
+
+func (e *accessLogEntry) appendLogfmt(b []byte) []byte {
+	req := e.ctx.Req
+	b = appendLogfmtField(b, "time", e.start.Format(time.RFC3339Nano))
+	if id := e.ctx.reqID; id != "" {
+		b = appendLogfmtField(b, "requestID", id)
+	}
+	b = appendLogfmtField(b, "clientIP", e.ctx.ClientIP())
+	if u := e.user(); u != "" {
+		b = appendLogfmtField(b, "user", u)
+	}
+	b = appendLogfmtField(b, "method", req.Method)
+	b = appendLogfmtField(b, "path", req.URL.Path)
+	if q := e.query(); q != "" {
+		b = appendLogfmtField(b, "query", q)
+	}
+	b = appendLogfmtField(b, "proto", req.Proto)
+	if r := e.route(); r != "" {
+		b = appendLogfmtField(b, "route", r)
+	}
+	b = appendLogfmtField(b, "status", strconv.Itoa(e.status()))
+	b = appendLogfmtField(b, "bytes", strconv.Itoa(e.ctx.BytesWritten()))
+	b = appendLogfmtField(b, "duration", e.dur.String())
+	if v := req.Referer(); v != "" {
+		b = appendLogfmtField(b, "referer", v)
+	}
+	if v := req.UserAgent(); v != "" {
+		b = appendLogfmtField(b, "userAgent", v)
+	}
+	for _, h := range e.al.opts.Headers {
+		if v := e.header(h); v != "" {
+			b = appendLogfmtField(b, http.CanonicalHeaderKey(h), v)
+		}
+	}
+	if body := e.loggedBody(); body != "" {
+		b = appendLogfmtField(b, "body", body)
+	}
+	return b
+}
+
+func appendLogfmtField(b []byte, k, v string) []byte {
+	if len(b) > 0 {
+		b = append(b, ' ')
+	}
+	b = append(b, k...)
+	b = append(b, '=')
+	if v == "" || strings.ContainsAny(v, " =\"\\\t\r\n") {
+		return strconv.AppendQuote(b, v)
+	}
+	return append(b, v...)
+}
+
+func parseAccessLogFormat(f string) (parts []accessLogPart, err error) {
+	lit := func(s string) accessLogPart {
+		return func(b []byte, _ *accessLogEntry) []byte { return append(b, s...) }
+	}
+
+	for len(f) > 0 {
+		i := strings.IndexByte(f, '%')
+		if i == -1 {
+			parts = append(parts, lit(f))
+			break
+		}
+		if i > 0 {
+			parts = append(parts, lit(f[:i]))
+		}
+		f = f[i+1:]
+
+		var arg string
+		if strings.HasPrefix(f, "{") {
+			j := strings.IndexByte(f, '}')
+			if j == -1 {
+				return nil, fmt.Errorf("gserv: unterminated access log directive %%%s", f)
+			}
+			arg, f = f[1:j], f[j+1:]
+		}
+		f = strings.TrimPrefix(f, ">")
+		if f == "" {
+			return nil, fmt.Errorf("gserv: incomplete access log directive at the end of the format")
+		}
+
+		p := accessLogDirective(f[0], arg)
+		if p == nil {
+			return nil, fmt.Errorf("gserv: invalid access log directive %%%c (%q)", f[0], arg)
+		}
+		parts = append(parts, p)
+		f = f[1:]
+	}
+	return
+}
+
+func accessLogDirective(c byte, arg string) accessLogPart {
+	str := func(fn func(e *accessLogEntry) string) accessLogPart {
+		return func(b []byte, e *accessLogEntry) []byte {
+			v := fn(e)
+			if v == "" {
+				v = "-"
+			}
+			return appendLogItem(b, v)
+		}
+	}
+
+	if arg != "" {
+		switch c {
+		case 'i':
+			return str(func(e *accessLogEntry) string { return e.header(arg) })
+		case 'o':
+			return str(func(e *accessLogEntry) string { return e.respHeader(arg) })
+		case 'x':
+			switch arg {
+			case "route":
+				return str((*accessLogEntry).route)
+			case "group":
+				return str((*accessLogEntry).group)
+			case "body":
+				return str((*accessLogEntry).loggedBody)
+			}
+		}
+		return nil
+	}
+
+	switch c {
+	case '%':
+		return func(b []byte, _ *accessLogEntry) []byte { return append(b, '%') }
+	case 'h':
+		return str(func(e *accessLogEntry) string { return e.ctx.ClientIP() })
+	case 'l':
+		return str(func(*accessLogEntry) string { return "" })
+	case 'u':
+		return str((*accessLogEntry).user)
+	case 't':
+		return func(b []byte, e *accessLogEntry) []byte {
+			b = append(b, '[')
+			b = e.start.AppendFormat(b, "02/Jan/2006:15:04:05 -0700")
+			return append(b, ']')
+		}
+	case 'r':
+		return func(b []byte, e *accessLogEntry) []byte {
+			req := e.ctx.Req
+			return appendLogItem(b, req.Method+" "+e.requestURI()+" "+req.Proto)
+		}
+	case 's':
+		return func(b []byte, e *accessLogEntry) []byte { return strconv.AppendInt(b, int64(e.status()), 10) }
+	case 'b':
+		return func(b []byte, e *accessLogEntry) []byte {
+			if n := e.ctx.BytesWritten(); n > 0 {
+				return strconv.AppendInt(b, int64(n), 10)
+			}
+			return append(b, '-')
+		}
+	case 'B':
+		return func(b []byte, e *accessLogEntry) []byte { return strconv.AppendInt(b, int64(e.ctx.BytesWritten()), 10) }
+	case 'D':
+		return func(b []byte, e *accessLogEntry) []byte { return strconv.AppendInt(b, e.dur.Microseconds(), 10) }
+	case 'T':
+		return func(b []byte, e *accessLogEntry) []byte { return strconv.AppendInt(b, int64(e.dur/time.Second), 10) }
+	case 'm':
+		return str(func(e *accessLogEntry) string { return e.ctx.Req.Method })
+	case 'U':
+		return str(func(e *accessLogEntry) string { return e.ctx.Req.URL.Path })
+	case 'q':
+		return func(b []byte, e *accessLogEntry) []byte {
+			if q := e.query(); q != "" {
+				return appendLogItem(b, "?"+q)
+			}
+			return b
+		}
+	case 'H':
+		return str(func(e *accessLogEntry) string { return e.ctx.Req.Proto })
+	case 'L':
+		return str(func(e *accessLogEntry) string { return e.ctx.reqID })
+	}
+	return nil
+}
+
+// appendLogItem appends v with quotes, backslashes and control characters escaped like Apache does,
+// so a value can't break out of its quotes or forge log lines, ex: a path with an encoded newline.
+func appendLogItem(b []byte, v string) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		case '\b':
+			b = append(b, '\\', 'b')
+		case '\v':
+			b = append(b, '\\', 'v')
+		default:
+			if c < 0x20 || c == 0x7f {
+				b = append(b, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return b
+}
+
+// redactJSON returns a compacted copy of b with the values of fields replaced with [REDACTED].
+// It works on truncated input, everything up to the first invalid token is kept.
+func redactJSON(b []byte, fields []string) []byte {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var (
+		out   []byte
+		stack []bool // true for objects
+		isKey bool   // the next token in an object is a key
+		comma bool   // a comma is needed before the next value or key
+		skip  int    // depth of a redacted value being skipped
+	)
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return out
+		}
+
+		if skip > 0 {
+			switch tok {
+			case json.Delim('{'), json.Delim('['):
+				skip++
+			case json.Delim('}'), json.Delim(']'):
+				skip--
+			}
+			if skip == 1 {
+				skip = 0
+			}
+			continue
+		}
+
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			out = append(out, byte(d))
+			stack = stack[:len(stack)-1]
+			isKey = len(stack) > 0 && stack[len(stack)-1]
+			comma = true
+			continue
+		}
+
+		if comma {
+			out = append(out, ',')
+			comma = false
+		}
+
+		if isKey {
+			k := tok.(string)
+			out = appendJSONString(out, k)
+			out = append(out, ':')
+			isKey = false
+			if redactField(k, fields) {
+				out = appendJSONString(out, redacted)
+				comma, isKey = true, true
+				// skip the value, objects and arrays are skipped until their closing delim
+				if tok, err = dec.Token(); err != nil {
+					return out
+				}
+				if d, ok := tok.(json.Delim); ok && (d == '{' || d == '[') {
+					skip = 2
+				}
+			}
+			continue
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			out = append(out, byte(v))
+			stack = append(stack, v == '{')
+			isKey = v == '{'
+			continue
+		case string:
+			out = appendJSONString(out, v)
+		case json.Number:
+			out = append(out, v...)
+		case bool:
+			out = strconv.AppendBool(out, v)
+		case nil:
+			out = append(out, "null"...)
+		}
+
+		comma = true
+		isKey = len(stack) > 0 && stack[len(stack)-1]
+	}
+}
+
+// redactForm returns b with the values of fields replaced with [REDACTED], b is returned as is if it isn't a valid form.
+func redactForm(b []byte, fields []string) []byte {
+	parts := strings.Split(string(b), "&")
+	for i, p := range parts {
+		k, _, _ := strings.Cut(p, "=")
+		if uk, err := url.QueryUnescape(k); err == nil && redactField(uk, fields) {
+			parts[i] = k + "=" + url.QueryEscape(redacted)
+		}
+	}
+	return []byte(strings.Join(parts, "&"))
+}
+
+func redactField(k string, fields []string) bool {
+	for _, f := range fields {
+		if strings.EqualFold(f, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package gserv
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BindRequest fills out, a pointer to a struct, from the request using the fields' tags, ex:
+//
+//	type ListReq struct {
+//		ID     int64     `path:"id"`
+//		Limit  int       `query:"limit"`
+//		Tags   []string  `query:"tag"`
+//		Since  time.Time `query:"since"` // RFC 3339 or 2006-01-02
+//		Tenant string    `header:"X-Tenant"`
+//		SID    string    `cookie:"sid"`
+//		Name   string    `form:"name"`
+//	}
+//
+// If there's a codec registered for the request's content-type, the body is decoded into out first, see Bind,
+// and out is validated once it's filled, see Validate.
+// Supported types are strings, bools, ints, uints, floats, time.Time, time.Duration, encoding.TextUnmarshaler,
+// pointers to and slices of them, and embedded structs.
+// Missing values are left as is, and the conversion errors are returned as a MultiError of Errors with their Field set,
+// which NewJSONErrorResponse renders as a 400 listing each field.
+func (ctx *Context) BindRequest(out any) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("gserv: BindRequest requires a pointer to a struct, got %T", out)
+	}
+
+	var me MultiError
+
+	ct, _, _ := mime.ParseMediaType(ctx.ContentType())
+	switch {
+	case ct == MimeForm, ct == "multipart/form-data":
+		if err := ctx.Req.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+			return NewError(http.StatusBadRequest, err)
+		}
+	case contentTypeCodec(ct) != nil:
+		if err := ctx.decodeBody(out); err != nil && !errors.Is(err, io.EOF) { // io.EOF: no body, ex: a GET
+			return NewError(http.StatusBadRequest, err)
+		}
+	}
+
+	v = v.Elem()
+	for _, f := range bindFieldsOf(v.Type()) {
+		vals := ctx.bindValues(f.src, f.name)
+		if len(vals) == 0 {
+			continue
+		}
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil { // nil embedded pointer
+			continue
+		}
+		if err := setBindValue(fv, vals); err != nil {
+			me.Push(Error{
+				Code:    http.StatusBadRequest,
+				Field:   f.name,
+				Message: fmt.Sprintf("invalid %s value %q for %s: %v", f.src, strings.Join(vals, ","), f.name, err),
+			})
+		}
+	}
+
+	if len(me) > 0 {
+		return me
+	}
+	return Validate(out)
+}
+
+func (ctx *Context) bindValues(src, name string) []string {
+	switch src {
+	case "path":
+		if v := ctx.Params.Get(name); v != "" {
+			return []string{v}
+		}
+	case "query":
+		return ctx.ReqQuery[name]
+	case "header":
+		return ctx.Req.Header.Values(name)
+	case "cookie":
+		if v, ok := ctx.GetCookie(name); ok {
+			return []string{v}
+		}
+	case "form":
+		return ctx.Req.PostForm[name]
+	}
+	return nil
+}
+
+var bindSources = [...]string{"path", "query", "header", "cookie", "form"}
+
+type bindField struct {
+	index []int
+	src   string
+	name  string
+}
+
+var bindCache sync.Map // map[reflect.Type][]bindField
+
+func bindFieldsOf(t reflect.Type) []bindField {
+	if v, ok := bindCache.Load(t); ok {
+		return v.([]bindField)
+	}
+
+	var out []bindField
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			continue // VisibleFields returns the promoted fields
+		}
+		for _, src := range bindSources {
+			if name, ok := sf.Tag.Lookup(src); ok && name != "" && name != "-" {
+				out = append(out, bindField{index: sf.Index, src: src, name: name})
+				break
+			}
+		}
+	}
+
+	bindCache.Store(t, out)
+	return out
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+func setBindValue(v reflect.Value, vals []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && !reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setBindScalar(s.Index(i), val); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setBindScalar(v, vals[0])
+}
+
+func setBindScalar(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if pv := v.Addr(); pv.Type().Implements(textUnmarshalerType) && v.Type() != timeType {
+		return pv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, s); err != nil {
+				return fmt.Errorf("expected RFC 3339 or YYYY-MM-DD")
+			}
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return numErr(err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return numErr(err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return numErr(err)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return numErr(err)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// numErr returns the underlying error of a strconv.NumError, ex: `invalid syntax`,
+// since the value is already in the message.
+func numErr(err error) error {
+	if ne, ok := err.(*strconv.NumError); ok {
+		return ne.Err
+	}
+	return err
+}
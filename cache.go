@@ -31,6 +31,14 @@ func cleanCache(m *cacheMap, ttl int64) {
 	}
 }
 
+// CacheStatusKey is the context key CacheHandler sets to CacheHit or CacheMiss, ex: ctx.Get(gserv.CacheStatusKey).
+const CacheStatusKey = ":CACHE:"
+
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
 func CacheHandler(etag func(ctx *Context) string, ttlDuration time.Duration, handler Handler) Handler {
 	c := cacheMap{}
 	ttl := int64(ttlDuration.Seconds())
@@ -55,7 +63,9 @@ func CacheHandler(etag func(ctx *Context) string, ttlDuration time.Duration, han
 			tag += ":0"
 		}
 
+		status := CacheHit
 		it := c.MustGet(tag, func() *cacheItem {
+			status = CacheMiss
 			resp := handler(ctx)
 			if cr, ok := resp.(CacheableResponse); ok {
 				resp = cr.Cached()
@@ -67,6 +77,8 @@ func CacheHandler(etag func(ctx *Context) string, ttlDuration time.Duration, han
 			}
 		})
 
+		ctx.Set(CacheStatusKey, status)
+
 		h := ctx.Header()
 		for k, v := range it.headers {
 			h[k] = v
@@ -0,0 +1,878 @@
+package gserv
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// CBORCodec encodes and decodes CBOR (RFC 8949).
+// Structs are encoded as maps keyed by their fields' `cbor` tag, then their json tag, then their Go name,
+// "omitempty" and "-" are supported like encoding/json.
+// Map keys are sorted (RFC 8949 section 4.2.1), time.Time is encoded as tag 0 (RFC 3339) and decoded from tags 0 and 1,
+// and encoding.TextMarshaler / TextUnmarshaler are used for non-struct types that implement them.
+// Decoding into an `any` returns int64 (uint64 if it doesn't fit), float64, string, []byte, bool, nil,
+// []any and map[string]any (map[any]any if any key isn't a string).
+type CBORCodec struct{}
+
+func (CBORCodec) ContentType() string { return MimeCBOR }
+
+func (CBORCodec) Decode(r io.Reader, out any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return io.EOF
+	}
+
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("cbor: %T is not a valid type, it must be a non-nil pointer", out)
+	}
+
+	d := cborDecoder{b: b}
+	if err := d.decode(v.Elem(), 0); err != nil {
+		return err
+	}
+	if d.off != len(d.b) {
+		return errors.New("cbor: unexpected data after the top-level value")
+	}
+	return nil
+}
+
+func (CBORCodec) Encode(w io.Writer, v any) error {
+	var e cborEncoder
+	if err := e.encode(reflect.ValueOf(v), 0); err != nil {
+		return err
+	}
+	_, err := w.Write(e.b)
+	return err
+}
+
+// major types
+const (
+	cborUint byte = iota << 5
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborFalse     = cborSimple | 20
+	cborTrue      = cborSimple | 21
+	cborNull      = cborSimple | 22
+	cborUndefined = cborSimple | 23
+	cborFloat16   = cborSimple | 25
+	cborFloat32   = cborSimple | 26
+	cborFloat64   = cborSimple | 27
+	cborBreak     = cborSimple | 31
+
+	cborIndefinite = 31
+	cborMaxDepth   = 1000
+)
+
+var errCBORDepth = errors.New("cbor: exceeded max nesting depth")
+
+type cborField struct {
+	index     []int
+	name      string
+	omitempty bool
+}
+
+var cborCache sync.Map // map[reflect.Type][]cborField
+
+func cborFieldsOf(t reflect.Type) []cborField {
+	if v, ok := cborCache.Load(t); ok {
+		return v.([]cborField)
+	}
+
+	var out []cborField
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag, ok := sf.Tag.Lookup("cbor")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if ft := sf.Type; sf.Anonymous && name == "" && (ft.Kind() == reflect.Struct || ft.Kind() == reflect.Pointer && ft.Elem().Kind() == reflect.Struct) {
+			continue // VisibleFields returns the promoted fields
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		out = append(out, cborField{index: sf.Index, name: name, omitempty: strings.Contains(","+opts+",", ",omitempty,")})
+	}
+
+	cborCache.Store(t, out)
+	return out
+}
+
+type cborEncoder struct {
+	b []byte
+}
+
+func (e *cborEncoder) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.b = append(e.b, major|byte(n))
+	case n <= math.MaxUint8:
+		e.b = append(e.b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.b = binary.BigEndian.AppendUint16(append(e.b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		e.b = binary.BigEndian.AppendUint32(append(e.b, major|26), uint32(n))
+	default:
+		e.b = binary.BigEndian.AppendUint64(append(e.b, major|27), n)
+	}
+}
+
+func (e *cborEncoder) int(n int64) {
+	if n < 0 {
+		e.head(cborNegInt, uint64(-(n + 1)))
+	} else {
+		e.head(cborUint, uint64(n))
+	}
+}
+
+func (e *cborEncoder) text(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *cborEncoder) float(f float64, bits int) {
+	if bits == 32 || float64(float32(f)) == f || math.IsNaN(f) {
+		e.b = binary.BigEndian.AppendUint32(append(e.b, cborFloat32), math.Float32bits(float32(f)))
+		return
+	}
+	e.b = binary.BigEndian.AppendUint64(append(e.b, cborFloat64), math.Float64bits(f))
+}
+
+func (e *cborEncoder) encode(v reflect.Value, depth int) error {
+	if depth > cborMaxDepth {
+		return errCBORDepth
+	}
+
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			e.b = append(e.b, cborNull)
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		e.b = append(e.b, cborNull)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		e.head(cborTag, 0)
+		e.text(v.Interface().(time.Time).Format(time.RFC3339Nano))
+		return nil
+	}
+
+	if v.Kind() != reflect.Struct && v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		e.text(string(b))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.b = append(e.b, cborTrue)
+		} else {
+			e.b = append(e.b, cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(cborUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.float(v.Float(), v.Type().Bits())
+	case reflect.String:
+		e.text(v.String())
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice && v.IsNil() {
+				e.b = append(e.b, cborNull)
+				return nil
+			}
+			e.head(cborBytes, uint64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				e.b = append(e.b, byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.b = append(e.b, cborNull)
+			return nil
+		}
+		e.head(cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.IsNil() {
+			e.b = append(e.b, cborNull)
+			return nil
+		}
+		return e.encodeMap(v, depth)
+
+	case reflect.Struct:
+		fields := cborFieldsOf(v.Type())
+		vals := make([]reflect.Value, 0, len(fields))
+		names := make([]string, 0, len(fields))
+		for _, f := range fields {
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil || (f.omitempty && isEmptyValue(fv)) {
+				continue
+			}
+			vals, names = append(vals, fv), append(names, f.name)
+		}
+		e.head(cborMap, uint64(len(vals)))
+		for i, fv := range vals {
+			e.text(names[i])
+			if err := e.encode(fv, depth+1); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// encodeMap encodes the map with its keys sorted by their encoded bytes, see RFC 8949 section 4.2.1.
+func (e *cborEncoder) encodeMap(v reflect.Value, depth int) error {
+	type kv struct {
+		k []byte
+		v reflect.Value
+	}
+
+	kvs := make([]kv, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var ke cborEncoder
+		if err := ke.encode(iter.Key(), depth+1); err != nil {
+			return err
+		}
+		kvs = append(kvs, kv{ke.b, iter.Value()})
+	}
+	sort.Slice(kvs, func(i, j int) bool { return bytes.Compare(kvs[i].k, kvs[j].k) < 0 })
+
+	e.head(cborMap, uint64(len(kvs)))
+	for _, kv := range kvs {
+		e.b = append(e.b, kv.k...)
+		if err := e.encode(kv.v, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cborDecoder struct {
+	b   []byte
+	off int
+}
+
+var errCBORShort = fmt.Errorf("cbor: %w", io.ErrUnexpectedEOF)
+
+func (d *cborDecoder) readByte() (byte, error) {
+	if d.off >= len(d.b) {
+		return 0, errCBORShort
+	}
+	c := d.b[d.off]
+	d.off++
+	return c, nil
+}
+
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)-d.off) {
+		return nil, errCBORShort
+	}
+	b := d.b[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// head reads an item's initial byte and argument, indefinite is set for indefinite length items.
+func (d *cborDecoder) head() (major, info byte, arg uint64, indefinite bool, err error) {
+	c, err := d.readByte()
+	if err != nil {
+		return
+	}
+	major, info = c&0xe0, c&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		var b []byte
+		if b, err = d.next(1 << (info - 24)); err != nil {
+			return
+		}
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+	case info == cborIndefinite && major >= cborBytes && major <= cborMap:
+		indefinite = true
+	case info == cborIndefinite && major == cborSimple:
+		err = errors.New("cbor: unexpected break")
+	default:
+		err = fmt.Errorf("cbor: invalid additional information %d for major type %d", info, major>>5)
+	}
+	return
+}
+
+// length checks that n items of at least minSize bytes can fit in the remaining data.
+func (d *cborDecoder) length(n uint64, minSize uint64) (int, error) {
+	if n > uint64(len(d.b)-d.off)/minSize {
+		return 0, errCBORShort
+	}
+	return int(n), nil
+}
+
+func (d *cborDecoder) isBreak() bool {
+	if d.off < len(d.b) && d.b[d.off] == cborBreak {
+		d.off++
+		return true
+	}
+	return false
+}
+
+// str reads a byte or text string, joining the chunks of indefinite length strings.
+func (d *cborDecoder) str(major byte, arg uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return d.next(arg)
+	}
+
+	var out []byte
+	for !d.isBreak() {
+		m, _, n, indef, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m != major || indef {
+			return nil, errors.New("cbor: invalid indefinite length string chunk")
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	if out == nil {
+		out = []byte{}
+	}
+	return out, nil
+}
+
+func (d *cborDecoder) text(arg uint64, indefinite bool) (string, error) {
+	b, err := d.str(cborText, arg, indefinite)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", errors.New("cbor: invalid utf-8 text string")
+	}
+	return string(b), nil
+}
+
+func cborFloat(info byte, arg uint64) float64 {
+	switch info {
+	case 25:
+		return float16(uint16(arg))
+	case 26:
+		return float64(math.Float32frombits(uint32(arg)))
+	default:
+		return math.Float64frombits(arg)
+	}
+}
+
+// float16 converts an IEEE 754 half-precision float, see RFC 8949 appendix D.
+func float16(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+func (d *cborDecoder) decode(v reflect.Value, depth int) error {
+	if depth > cborMaxDepth {
+		return errCBORDepth
+	}
+
+	if d.off < len(d.b) && (d.b[d.off] == cborNull || d.b[d.off] == cborUndefined) {
+		d.off++
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem(), depth)
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("cbor: can't decode into %s", v.Type())
+		}
+		if !v.IsNil() && v.Elem().Kind() == reflect.Pointer { // decode into the existing pointer, like encoding/json
+			return d.decode(v.Elem(), depth)
+		}
+		x, err := d.decodeAny(depth)
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	if v.Type() == timeType {
+		var tag uint64 // untagged values are decoded like tags 0 and 1
+		if d.off < len(d.b) && d.b[d.off]&0xe0 == cborTag {
+			_, _, arg, _, err := d.head()
+			if err != nil {
+				return err
+			}
+			tag = arg
+		}
+		return d.decodeTime(v, tag, depth)
+	}
+
+	major, info, arg, indefinite, err := d.head()
+	if err != nil {
+		return err
+	}
+
+	if major == cborTag {
+		return d.decode(v, depth+1) // other tags are ignored
+	}
+
+	if major == cborText {
+		if pv := v.Addr(); pv.Type().Implements(textUnmarshalerType) {
+			s, err := d.text(arg, indefinite)
+			if err != nil {
+				return err
+			}
+			return pv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cbor: can't decode major type %d into %s", major>>5, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if major != cborSimple || (info != 20 && info != 21) {
+			return mismatch()
+		}
+		v.SetBool(info == 21)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch {
+		case major == cborUint && arg <= math.MaxInt64:
+			n = int64(arg)
+		case major == cborNegInt && arg <= math.MaxInt64:
+			n = -1 - int64(arg)
+		case major == cborUint, major == cborNegInt:
+			return fmt.Errorf("cbor: %d overflows %s", arg, v.Type())
+		default:
+			return mismatch()
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("cbor: %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if major != cborUint {
+			return mismatch()
+		}
+		if v.OverflowUint(arg) {
+			return fmt.Errorf("cbor: %d overflows %s", arg, v.Type())
+		}
+		v.SetUint(arg)
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch {
+		case major == cborSimple && info >= 25 && info <= 27:
+			f = cborFloat(info, arg)
+		case major == cborUint:
+			f = float64(arg)
+		case major == cborNegInt:
+			f = -1 - float64(arg)
+		default:
+			return mismatch()
+		}
+		v.SetFloat(f)
+
+	case reflect.String:
+		if major != cborText {
+			return mismatch()
+		}
+		s, err := d.text(arg, indefinite)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && major == cborBytes {
+			b, err := d.str(cborBytes, arg, indefinite)
+			if err != nil {
+				return err
+			}
+			if v.Kind() == reflect.Array {
+				reflect.Copy(v, reflect.ValueOf(b))
+			} else {
+				v.SetBytes(bytes.Clone(b))
+			}
+			return nil
+		}
+		if major != cborArray {
+			return mismatch()
+		}
+		return d.decodeArray(v, arg, indefinite, depth)
+
+	case reflect.Map:
+		if major != cborMap {
+			return mismatch()
+		}
+		return d.decodeMap(v, arg, indefinite, depth)
+
+	case reflect.Struct:
+		if major != cborMap {
+			return mismatch()
+		}
+		return d.decodeStruct(v, arg, indefinite, depth)
+
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeArray(v reflect.Value, arg uint64, indefinite bool, depth int) error {
+	if indefinite {
+		if v.Kind() == reflect.Slice {
+			v.SetLen(0)
+		}
+		for i := 0; !d.isBreak(); i++ {
+			if v.Kind() == reflect.Slice {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			} else if i >= v.Len() {
+				if err := d.skip(depth + 1); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n, err := d.length(arg, 1)
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	}
+	for i := 0; i < n; i++ {
+		if i >= v.Len() {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.decode(v.Index(i), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entries calls fn for each key of a map, fn must consume the value.
+func (d *cborDecoder) entries(arg uint64, indefinite bool, fn func() error) error {
+	if indefinite {
+		for !d.isBreak() {
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n, err := d.length(arg, 2)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeMap(v reflect.Value, arg uint64, indefinite bool, depth int) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	return d.entries(arg, indefinite, func() error {
+		k := reflect.New(t.Key()).Elem()
+		if err := d.decode(k, depth+1); err != nil {
+			return err
+		}
+		if k.Kind() == reflect.Interface && (k.IsNil() || !k.Elem().Type().Comparable()) {
+			return fmt.Errorf("cbor: invalid map key type %T", k.Interface())
+		}
+		e := reflect.New(t.Elem()).Elem()
+		if err := d.decode(e, depth+1); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, e)
+		return nil
+	})
+}
+
+func (d *cborDecoder) decodeStruct(v reflect.Value, arg uint64, indefinite bool, depth int) error {
+	fields := cborFieldsOf(v.Type())
+	return d.entries(arg, indefinite, func() error {
+		var key any
+		if err := d.decode(reflect.ValueOf(&key).Elem(), depth+1); err != nil {
+			return err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return d.skip(depth + 1)
+		}
+
+		var f *cborField
+		for i := range fields {
+			if fields[i].name == name {
+				f = &fields[i]
+				break
+			}
+		}
+		if f == nil {
+			for i := range fields {
+				if strings.EqualFold(fields[i].name, name) {
+					f = &fields[i]
+					break
+				}
+			}
+		}
+		if f == nil {
+			return d.skip(depth + 1)
+		}
+		return d.decode(fieldByIndexAlloc(v, f.index), depth+1)
+	})
+}
+
+func (d *cborDecoder) decodeTime(v reflect.Value, tag uint64, depth int) error {
+	var x any
+	if err := d.decode(reflect.ValueOf(&x).Elem(), depth+1); err != nil {
+		return err
+	}
+
+	var t time.Time
+	switch x := x.(type) {
+	case string:
+		if tag != 0 {
+			return fmt.Errorf("cbor: can't decode tag %d into time.Time", tag)
+		}
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, x); err != nil {
+			return fmt.Errorf("cbor: %w", err)
+		}
+	case int64:
+		t = time.Unix(x, 0)
+	case uint64:
+		return fmt.Errorf("cbor: %d overflows time.Time", x)
+	case float64:
+		sec, frac := math.Modf(x)
+		t = time.Unix(int64(sec), int64(frac*1e9))
+	default:
+		return fmt.Errorf("cbor: can't decode tag %d into time.Time", tag)
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func (d *cborDecoder) skip(depth int) error {
+	var x any
+	return d.decode(reflect.ValueOf(&x).Elem(), depth)
+}
+
+func (d *cborDecoder) decodeAny(depth int) (any, error) {
+	if depth > cborMaxDepth {
+		return nil, errCBORDepth
+	}
+
+	major, info, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if arg <= math.MaxInt64 {
+			return int64(arg), nil
+		}
+		return arg, nil
+	case cborNegInt:
+		if arg <= math.MaxInt64 {
+			return -1 - int64(arg), nil
+		}
+		return nil, fmt.Errorf("cbor: -1-%d overflows int64", arg)
+	case cborBytes:
+		b, err := d.str(cborBytes, arg, indefinite)
+		return bytes.Clone(b), err
+	case cborText:
+		return d.text(arg, indefinite)
+
+	case cborArray:
+		var out []any
+		if !indefinite {
+			n, err := d.length(arg, 1)
+			if err != nil {
+				return nil, err
+			}
+			out = make([]any, 0, n)
+		}
+		for i := 0; indefinite || i < int(arg); i++ {
+			if indefinite && d.isBreak() {
+				break
+			}
+			x, err := d.decodeAny(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, x)
+		}
+		if out == nil {
+			out = []any{}
+		}
+		return out, nil
+
+	case cborMap:
+		var (
+			keys, vals []any
+			allStrings = true
+		)
+		err := d.entries(arg, indefinite, func() error {
+			k, err := d.decodeAny(depth + 1)
+			if err != nil {
+				return err
+			}
+			v, err := d.decodeAny(depth + 1)
+			if err != nil {
+				return err
+			}
+			if _, ok := k.(string); !ok {
+				allStrings = false
+			}
+			keys, vals = append(keys, k), append(vals, v)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if allStrings {
+			m := make(map[string]any, len(keys))
+			for i, k := range keys {
+				m[k.(string)] = vals[i]
+			}
+			return m, nil
+		}
+		m := make(map[any]any, len(keys))
+		for i, k := range keys {
+			if k == nil || !reflect.TypeOf(k).Comparable() {
+				return nil, fmt.Errorf("cbor: invalid map key type %T", k)
+			}
+			m[k] = vals[i]
+		}
+		return m, nil
+
+	case cborTag:
+		if arg == 0 || arg == 1 {
+			var t time.Time
+			if err := d.decodeTime(reflect.ValueOf(&t).Elem(), arg, depth); err != nil {
+				return nil, err
+			}
+			return t, nil
+		}
+		return d.decodeAny(depth + 1)
+
+	default: // cborSimple
+		switch info {
+		case 20, 21:
+			return info == 21, nil
+		case 22, 23:
+			return nil, nil
+		case 25, 26, 27:
+			return cborFloat(info, arg), nil
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", arg)
+	}
+}
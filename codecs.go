@@ -1,7 +1,10 @@
 package gserv
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +18,8 @@ const (
 	MimeEvent      = "text/event-stream"
 	MimeMsgPack    = "application/msgpack"
 	MimeXML        = "application/xml"
+	MimeCBOR       = "application/cbor"
+	MimeForm       = "application/x-www-form-urlencoded"
 	MimeJavascript = "application/javascript"
 	MimeHTML       = "text/html"
 	MimePlain      = "text/plain"
@@ -25,6 +30,9 @@ var (
 	_ Codec = (*PlainTextCodec)(nil)
 	_ Codec = (*JSONCodec)(nil)
 	_ Codec = (*MsgpCodec)(nil)
+	_ Codec = (*XMLCodec)(nil)
+	_ Codec = (*CBORCodec)(nil)
+	_ Codec = (*FormCodec)(nil)
 	_ Codec = (*MixedCodec[JSONCodec, MsgpCodec])(nil)
 )
 
@@ -104,6 +112,26 @@ func (c MsgpCodec) Encode(w io.Writer, v any) error {
 	return genh.EncodeMsgpack(w, v)
 }
 
+// XMLCodec encodes and decodes using encoding/xml, it doesn't support maps, ex: M.
+type XMLCodec struct{ Indent bool }
+
+func (XMLCodec) ContentType() string { return MimeXML }
+
+func (XMLCodec) Decode(r io.Reader, out any) error {
+	return xml.NewDecoder(r).Decode(out)
+}
+
+func (x XMLCodec) Encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if x.Indent {
+		enc.Indent("", "\t")
+	}
+	return enc.Encode(v)
+}
+
 type MixedCodec[Dec, Enc Codec] struct {
 	dec Dec
 	enc Enc
@@ -123,5 +151,8 @@ func getError(err error) HTTPError {
 	if err, ok := err.(HTTPError); ok {
 		return err
 	}
+	if errors.Is(err, context.DeadlineExceeded) { // ex: a db call that used the deadline set by Timeout
+		return &Error{Code: http.StatusGatewayTimeout, Message: err.Error()}
+	}
 	return &Error{Code: http.StatusBadRequest, Message: err.Error()}
 }
@@ -0,0 +1,141 @@
+package gserv
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConcurrencyOptions are the options of ConcurrencyLimit.
+type ConcurrencyOptions struct {
+	// Limit is the max number of requests served at the same time, it's the upper bound in adaptive mode.
+	Limit int
+
+	// QueueSize is the max number of requests waiting for a slot, once the queue is full, requests are shed.
+	QueueSize int
+
+	// QueueTimeout is the max time a request waits in the queue, defaults to 1 second.
+	QueueTimeout time.Duration
+
+	// RetryAfter is the value of the Retry-After header of shed requests, defaults to 1 second.
+	RetryAfter time.Duration
+
+	// LatencyTarget enables the adaptive (AIMD) mode: the limit is increased by 1 for every Limit requests served
+	// faster than LatencyTarget, and decreased by 10% (down to MinLimit) for each one that's slower or fails with a 5xx.
+	LatencyTarget time.Duration
+
+	// MinLimit is the lower bound in adaptive mode, defaults to 1.
+	MinLimit int
+}
+
+// ConcurrencyLimit returns a middleware that caps the number of in-flight requests of the group or route it's used on,
+// queuing the rest up to opts.QueueSize, and responding with a 503 and Retry-After once the queue is full or times out.
+// It can be used as a group middleware, or as the first handler of a route, ex:
+//
+//	api.POST("/report", ConcurrencyLimit(ConcurrencyOptions{Limit: 4, QueueSize: 16}), report)
+//
+// It panics if opts.Limit < 1.
+func ConcurrencyLimit(opts ConcurrencyOptions) Handler {
+	if opts.Limit < 1 {
+		panic("gserv: ConcurrencyLimit requires a limit > 0")
+	}
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = time.Second
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
+	if opts.MinLimit < 1 {
+		opts.MinLimit = 1
+	}
+
+	cl := &concurrencyLimiter{opts: opts, limit: float64(opts.Limit)}
+	retryAfter := strconv.Itoa(int(math.Ceil(opts.RetryAfter.Seconds())))
+
+	return func(ctx *Context) Response {
+		if !cl.acquire(ctx) {
+			ctx.Header().Set("Retry-After", retryAfter)
+			return NewJSONErrorResponse(http.StatusServiceUnavailable)
+		}
+
+		start := time.Now()
+		defer func() {
+			cl.release(time.Since(start), ctx.Status())
+		}()
+
+		ctx.NextMiddleware()
+		ctx.Next()
+		return nil
+	}
+}
+
+type concurrencyLimiter struct {
+	opts ConcurrencyOptions
+
+	mux      sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  []chan struct{}
+}
+
+func (cl *concurrencyLimiter) acquire(ctx *Context) bool {
+	cl.mux.Lock()
+	if cl.inFlight < int(cl.limit) && len(cl.waiters) == 0 {
+		cl.inFlight++
+		cl.mux.Unlock()
+		return true
+	}
+
+	if len(cl.waiters) >= cl.opts.QueueSize {
+		cl.mux.Unlock()
+		return false
+	}
+
+	ch := make(chan struct{})
+	cl.waiters = append(cl.waiters, ch)
+	cl.mux.Unlock()
+
+	t := time.NewTimer(cl.opts.QueueTimeout)
+	defer t.Stop()
+
+	select {
+	case <-ch:
+		return true
+	case <-t.C:
+	case <-ctx.Req.Context().Done():
+	}
+
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+	for i, w := range cl.waiters {
+		if w == ch {
+			cl.waiters = append(cl.waiters[:i], cl.waiters[i+1:]...)
+			return false
+		}
+	}
+
+	// we got a slot while timing out
+	return true
+}
+
+func (cl *concurrencyLimiter) release(latency time.Duration, status int) {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	if o := &cl.opts; o.LatencyTarget > 0 {
+		if latency > o.LatencyTarget || status >= http.StatusInternalServerError {
+			cl.limit = math.Max(float64(o.MinLimit), cl.limit*0.9)
+		} else {
+			cl.limit = math.Min(float64(o.Limit), cl.limit+1/cl.limit)
+		}
+	}
+
+	cl.inFlight--
+	for len(cl.waiters) > 0 && cl.inFlight < int(cl.limit) {
+		cl.inFlight++
+		close(cl.waiters[0])
+		cl.waiters = cl.waiters[1:]
+	}
+}
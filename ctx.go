@@ -1,8 +1,10 @@
 package gserv
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime"
 	"mime/multipart"
 	"net"
@@ -45,24 +47,32 @@ type Context struct {
 	http.ResponseWriter
 	Codec Codec
 
-	nextMW       func()
+	nextMW       func(ctx *Context)
 	s            *Server
 	data         M
 	Req          *http.Request
-	next         func()
+	next         func(ctx *Context)
 	ReqQuery     url.Values
 	Params       router.Params
 	bytesWritten int
 	status       int
+	reqID        string
+	logger       *slog.Logger
 
 	hijackServeContent bool
 	done               bool
+	panicked           bool
 }
 
 func (ctx *Context) Route() *router.Route {
 	return router.RouteFromRequest(ctx.Req)
 }
 
+// URLFor returns the escaped path of a named route, see Server.URLFor.
+func (ctx *Context) URLFor(name string, params ...string) (string, error) {
+	return ctx.s.URLFor(name, params...)
+}
+
 // Param is a shorthand for ctx.Params.Get(name).
 func (ctx *Context) Param(key string) string {
 	return ctx.Params.Get(key)
@@ -117,6 +127,11 @@ func (ctx *Context) Path() string {
 	return ctx.Req.URL.EscapedPath()
 }
 
+// OriginalPath returns the request's path before the router cleaned it, see router.OriginalPath.
+func (ctx *Context) OriginalPath() string {
+	return router.OriginalPath(ctx.Req)
+}
+
 // SetContentType sets the responses's content-type.
 func (ctx *Context) SetContentType(typ string) {
 	if typ == "" {
@@ -147,38 +162,39 @@ func (ctx *Context) CloseBody() error {
 	return ctx.Req.Body.Close()
 }
 
-// BindJSON parses the request's body as json, and closes the body.
-// Note that unlike gin.Context.Bind, this does NOT verify the fields using special tags.
+// BindJSON parses the request's body as json, closes the body and validates out, see Validate.
 func (ctx *Context) BindJSON(out any) error {
 	return ctx.BindCodec(JSONCodec{}, out)
 }
 
-// BindMsgpoack parses the request's body as msgpack, and closes the body.
-// Note that unlike gin.Context.Bind, this does NOT verify the fields using special tags.
+// BindMsgpoack parses the request's body as msgpack, closes the body and validates out, see Validate.
 func (ctx *Context) BindMsgpack(out any) error {
 	return ctx.BindCodec(MsgpCodec{}, out)
 }
 
-// BindCodec parses the request's body as msgpack, and closes the body.
-// Note that unlike gin.Context.BindCodec, this does NOT verify the fields using special tags.
+// BindCodec parses the request's body using c, closes the body and validates out, see Validate.
 func (ctx *Context) BindCodec(c Codec, out any) error {
 	c = genh.FirstNonZero(c, ctx.Codec, DefaultCodec)
 	err := c.Decode(ctx, out)
 	ctx.CloseBody()
-	return err
+	if err != nil {
+		return err
+	}
+	return Validate(out)
 }
 
-// Bind parses the request's body as msgpack, and closes the body.
-// Note that unlike gin.Context.Bind, this does NOT verify the fields using special tags.
+// Bind parses the request's body using the codec registered for its content-type, see RegisterCodec, closes the body and validates out, see Validate.
 func (ctx *Context) Bind(out any) error {
-	var c Codec
+	if err := ctx.decodeBody(out); err != nil {
+		return err
+	}
+	return Validate(out)
+}
+
+func (ctx *Context) decodeBody(out any) error {
 	ct := ctx.ContentType()
-	switch {
-	case strings.Contains(ct, "json"):
-		c = JSONCodec{}
-	case strings.Contains(ct, "msgpack"):
-		c = MsgpCodec{}
-	default:
+	c := contentTypeCodec(ct)
+	if c == nil {
 		c = genh.FirstNonZero(ctx.Codec, DefaultCodec)
 	}
 
@@ -224,74 +240,166 @@ func (ctx *Context) EncodeCodec(c Codec, code int, v any) error {
 	c = genh.FirstNonZero(c, ctx.Codec, DefaultCodec)
 	ctx.done = true
 	ctx.SetContentType(c.ContentType())
+	return ctx.encode(c, code, v)
+}
+
+var encodeBufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// encode buffers v encoded with c before writing code and the body, so if encoding fails, ex: XMLCodec with a map,
+// the error is logged and returned, and the client gets a 500 rather than an empty response.
+func (ctx *Context) encode(c Codec, code int, v any) error {
+	buf := encodeBufPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		encodeBufPool.Put(buf)
+	}()
+
+	if err := c.Encode(buf, v); err != nil {
+		ctx.Logf("error encoding %T as %s: %v", v, c.ContentType(), err)
+		NewJSONErrorResponse(http.StatusInternalServerError, "internal server error").WriteToCtx(ctx)
+		return err
+	}
 
 	if code > 0 {
 		ctx.WriteHeader(code)
 	}
-	return c.Encode(ctx, v)
+	_, err := ctx.Write(buf.Bytes())
+	return err
 }
 
+// Encode encodes v using the codec registered for the request's content-type, unless the Accept header explicitly
+// names a different registered media type, wildcards like */* don't override the content-type, see Negotiate
+// to always pick the codec from the Accept header.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
 func (ctx *Context) Encode(code int, v any) error {
 	var c Codec
-	ct := ctx.ContentType()
-	switch {
-	case strings.Contains(ct, "json"):
-		c = JSONCodec{}
-	case strings.Contains(ct, "msgpack"):
-		c = MsgpCodec{}
-	default:
+	if accept := ctx.ReqHeader("Accept"); accept != "" {
+		ctx.varyAccept()
+		c = acceptedCodec(accept, responseCodec(ctx.ContentType()))
+	} else {
+		c = responseCodec(ctx.ContentType())
+	}
+	if c == nil {
 		c = genh.FirstNonZero(ctx.Codec, DefaultCodec)
 	}
 
 	ctx.done = true
 	ctx.SetContentType(c.ContentType())
+	return ctx.encode(c, code, v)
+}
 
-	if code > 0 {
-		ctx.WriteHeader(code)
+// ClientIP returns the current client ip.
+// If the request comes from one of Options.TrustedProxies, it's the rightmost untrusted address in
+// Options.TrustedProxyHeader, otherwise the forwarding headers are ignored and it's the address of the peer.
+func (ctx *Context) ClientIP() string {
+	ip, _ := ctx.forwarded()
+	return ip
+}
+
+// Scheme returns the request's scheme, `http` or `https`, accounting for the Forwarded proto param or
+// the X-Forwarded-Proto header if the request comes from a trusted proxy, see ClientIP.
+func (ctx *Context) Scheme() string {
+	if _, trusted := ctx.forwarded(); trusted {
+		var v string
+		if ctx.proxyHeader() == ProxyHeaderForwarded {
+			v = forwardedParam(ctx.Req.Header, "proto")
+		} else {
+			v = lastValue(ctx.Req.Header.Get("X-Forwarded-Proto"))
+		}
+		if v != "" {
+			return strings.ToLower(v)
+		}
 	}
-	return c.Encode(ctx, v)
+
+	if ctx.Req.TLS != nil {
+		return "https"
+	}
+	return "http"
 }
 
-// ClientIP returns the current client ip, accounting for X-Real-Ip and X-forwarded-For headers as well.
-func (ctx *Context) ClientIP() string {
-	h := ctx.Req.Header
+// Host returns the request's host, accounting for the Forwarded host param or
+// the X-Forwarded-Host header if the request comes from a trusted proxy, see ClientIP.
+func (ctx *Context) Host() string {
+	if _, trusted := ctx.forwarded(); trusted {
+		var v string
+		if ctx.proxyHeader() == ProxyHeaderForwarded {
+			v = forwardedParam(ctx.Req.Header, "host")
+		} else {
+			v = lastValue(ctx.Req.Header.Get("X-Forwarded-Host"))
+		}
+		if v != "" {
+			return v
+		}
+	}
+	return ctx.Req.Host
+}
 
-	// handle proxies
-	if ip := h.Get("X-Real-Ip"); ip != "" {
-		return strings.TrimSpace(ip)
+// forwarded returns the client ip and whether the peer is a trusted proxy.
+func (ctx *Context) forwarded() (ip string, trusted bool) {
+	peer := ctx.peer()
+	tp := ctx.s.opts.TrustedProxies
+	if !isTrusted(tp, peer) {
+		return peer, false
 	}
 
-	if ip := h.Get("X-Forwarded-For"); ip != "" {
-		if index := strings.IndexByte(ip, ','); index >= 0 {
-			if ip = strings.TrimSpace(ip[:index]); len(ip) > 0 {
-				return ip
-			}
+	var hops []string
+	switch h := ctx.Req.Header; ctx.proxyHeader() {
+	case ProxyHeaderForwarded:
+		hops = forwardedFor(h)
+	case ProxyHeaderXRealIP:
+		if ip := strings.TrimSpace(h.Get(ProxyHeaderXRealIP)); ip != "" {
+			return ip, true
 		}
+	default:
+		hops = splitValues(h.Values(ProxyHeaderXForwardedFor))
+	}
+	if len(hops) == 0 {
+		return peer, true
+	}
 
-		if ip = strings.TrimSpace(ip); ip != "" {
-			return ip
+	for i := len(hops) - 1; i > 0; i-- {
+		if !isTrusted(tp, hops[i]) {
+			return hops[i], true
 		}
 	}
+	return hops[0], true
+}
 
-	if ip, _, err := net.SplitHostPort(strings.TrimSpace(ctx.Req.RemoteAddr)); err == nil {
-		return ip
+func (ctx *Context) proxyHeader() string {
+	if h := ctx.s.opts.TrustedProxyHeader; h != "" {
+		return h
 	}
+	return ProxyHeaderXForwardedFor
+}
+
+// peer returns the ip of the connection's remote end.
+func (ctx *Context) peer() string {
+	peer := strings.TrimSpace(ctx.Req.RemoteAddr)
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	return peer
+}
 
-	return ""
+// fromTrustedProxy returns true if the request comes from one of Options.TrustedProxies.
+func (ctx *Context) fromTrustedProxy() bool {
+	return isTrusted(ctx.s.opts.TrustedProxies, ctx.peer())
 }
 
 // NextMiddleware is a middleware-only func to execute all the other middlewares in the group and return before the handlers.
 // will panic if called from a handler.
 func (ctx *Context) NextMiddleware() {
 	if ctx.nextMW != nil {
-		ctx.nextMW()
+		ctx.nextMW(ctx)
 	}
 }
 
 // NextHandler is a func to execute all the handlers in the group up until one returns a Response.
 func (ctx *Context) NextHandler() {
 	if ctx.next != nil {
-		ctx.next()
+		ctx.next(ctx)
 	}
 }
 
@@ -332,7 +440,7 @@ func (ctx *Context) BytesWritten() int {
 
 // Write implements io.StringWriter
 func (ctx *Context) WriteString(p string) (int, error) {
-	return ctx.ResponseWriter.Write(otk.UnsafeBytes(p))
+	return ctx.Write(otk.UnsafeBytes(p))
 }
 
 // Write implements http.Flusher
@@ -402,7 +510,7 @@ func (ctx *Context) SetCookie(name string, value any, domain string, forceHTTPS
 		Value:    encValue,
 		Domain:   domain,
 		HttpOnly: true,
-		Secure:   forceHTTPS || ctx.Req.TLS != nil,
+		Secure:   forceHTTPS || ctx.Scheme() == "https",
 	}
 
 	switch duration {
@@ -457,11 +565,38 @@ func (ctx *Context) GetCookieValue(name string, valDst any) error {
 }
 
 func (ctx *Context) Logf(format string, v ...any) {
-	ctx.s.logfStack(1, format, v...)
+	ctx.s.logStack(1, ctx.slogger(), format, v...)
 }
 
 func (ctx *Context) LogSkipf(skip int, format string, v ...any) {
-	ctx.s.logfStack(skip+1, format, v...)
+	ctx.s.logStack(skip+1, ctx.slogger(), format, v...)
+}
+
+// slogger returns ctx.Logger() if the server has a structured logger.
+func (ctx *Context) slogger() *slog.Logger {
+	if ctx.s.opts.SLogger == nil {
+		return nil
+	}
+	return ctx.Logger()
+}
+
+// Logger returns the server's structured logger with the request's id (if any), route, method and client ip attributes.
+func (ctx *Context) Logger() *slog.Logger {
+	if ctx.logger != nil {
+		return ctx.logger
+	}
+
+	attrs := make([]any, 0, 8)
+	if ctx.reqID != "" {
+		attrs = append(attrs, "requestID", ctx.reqID)
+	}
+	if rn := ctx.Route(); rn != nil {
+		attrs = append(attrs, "route", rn.Path())
+	}
+	attrs = append(attrs, "method", ctx.Req.Method, "clientIP", ctx.ClientIP())
+
+	ctx.logger = ctx.s.SLogger().With(attrs...)
+	return ctx.logger
 }
 
 var ctxPool = sync.Pool{
@@ -13,11 +13,12 @@ type HTTPError interface {
 }
 
 var (
-	ErrBadRequest   = NewError(http.StatusBadRequest, "bad request")
-	ErrUnauthorized = NewError(http.StatusUnauthorized, "unauthorized")
-	ErrForbidden    = NewError(http.StatusForbidden, "the gates of time are closed")
-	ErrNotFound     = NewError(http.StatusNotFound, "not found")
-	ErrTeaPot       = NewError(http.StatusTeapot, "I'm a teapot")
+	ErrBadRequest    = NewError(http.StatusBadRequest, "bad request")
+	ErrUnauthorized  = NewError(http.StatusUnauthorized, "unauthorized")
+	ErrForbidden     = NewError(http.StatusForbidden, "the gates of time are closed")
+	ErrNotFound      = NewError(http.StatusNotFound, "not found")
+	ErrNotAcceptable = NewError(http.StatusNotAcceptable, "not acceptable")
+	ErrTeaPot        = NewError(http.StatusTeapot, "I'm a teapot")
 
 	ErrInternal = NewError(http.StatusInternalServerError, "internal error")
 	ErrNotImpl  = NewError(http.StatusNotImplemented, "not implemented")
@@ -25,6 +26,7 @@ var (
 
 type Error struct {
 	Caller  *callerInfo `json:"caller,omitempty"`
+	Field   string      `json:"field,omitempty"` // the request field the error is about, see Context.BindRequest
 	Message string      `json:"message,omitempty"`
 	Code    int         `json:"code,omitempty"`
 }
@@ -0,0 +1,244 @@
+package gserv
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FormCodec decodes application/x-www-form-urlencoded bodies into url.Values, map[string]string,
+// map[string][]string, map[string]any or structs, and encodes the same types.
+// Struct fields are named after their `form` tag, then their json tag, then their Go name,
+// and support the same types as BindRequest, nested structs and maps aren't supported.
+// Decoding errors are returned as a MultiError of Errors with their Field set.
+type FormCodec struct{}
+
+func (FormCodec) ContentType() string { return MimeForm }
+
+func (FormCodec) Decode(r io.Reader, out any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	vals, err := url.ParseQuery(string(b))
+	if err != nil {
+		return NewError(http.StatusBadRequest, err)
+	}
+
+	switch out := out.(type) {
+	case *url.Values:
+		*out = vals
+		return nil
+	case *map[string][]string:
+		*out = vals
+		return nil
+	case *map[string]string:
+		m := make(map[string]string, len(vals))
+		for k := range vals {
+			m[k] = vals.Get(k)
+		}
+		*out = m
+		return nil
+	case *map[string]any:
+		m := make(map[string]any, len(vals))
+		for k, v := range vals {
+			if len(v) == 1 {
+				m[k] = v[0]
+			} else {
+				m[k] = v
+			}
+		}
+		*out = m
+		return nil
+	}
+
+	v := reflect.ValueOf(out)
+	for v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Pointer { // ex: **T from the generic handlers
+		if v.Elem().IsNil() {
+			v.Elem().Set(reflect.New(v.Elem().Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a valid type for FormCodec", out)
+	}
+
+	var me MultiError
+	v = v.Elem()
+	for _, f := range formFieldsOf(v.Type()) {
+		fv := vals[f.name]
+		if len(fv) == 0 {
+			continue
+		}
+		if err := setBindValue(fieldByIndexAlloc(v, f.index), fv); err != nil {
+			me.Push(Error{
+				Code:    http.StatusBadRequest,
+				Field:   f.name,
+				Message: fmt.Sprintf("invalid form value %q for %s: %v", strings.Join(fv, ","), f.name, err),
+			})
+		}
+	}
+
+	if len(me) > 0 {
+		return me
+	}
+	return nil
+}
+
+func (FormCodec) Encode(w io.Writer, v any) error {
+	var vals url.Values
+	switch v := v.(type) {
+	case url.Values:
+		vals = v
+	case map[string][]string:
+		vals = v
+	case map[string]string:
+		vals = make(url.Values, len(v))
+		for k, s := range v {
+			vals.Set(k, s)
+		}
+	case map[string]any:
+		vals = make(url.Values, len(v))
+		for k, fv := range v {
+			if err := appendFormValue(vals, k, reflect.ValueOf(fv)); err != nil {
+				return err
+			}
+		}
+	default:
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return fmt.Errorf("%T is not a valid type for FormCodec", v)
+		}
+
+		vals = url.Values{}
+		for _, f := range formFieldsOf(rv.Type()) {
+			fv, err := rv.FieldByIndexErr(f.index)
+			if err != nil { // nil embedded pointer
+				continue
+			}
+			if err := appendFormValue(vals, f.name, fv); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, vals.Encode())
+	return err
+}
+
+type formField struct {
+	index []int
+	name  string
+}
+
+var formCache sync.Map // map[reflect.Type][]formField
+
+func formFieldsOf(t reflect.Type) []formField {
+	if v, ok := formCache.Load(t); ok {
+		return v.([]formField)
+	}
+
+	var out []formField
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() || (sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		name := sf.Tag.Get("form")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if name = fieldName(sf); name == "-" {
+				continue
+			}
+		}
+		out = append(out, formField{index: sf.Index, name: name})
+	}
+
+	formCache.Store(t, out)
+	return out
+}
+
+// fieldByIndexAlloc is v.FieldByIndex, allocating nil embedded pointers.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func appendFormValue(vals url.Values, name string, v reflect.Value) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && !v.Type().Implements(textMarshalerType) {
+		for i := 0; i < v.Len(); i++ {
+			if err := appendFormValue(vals, name, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, err := formatBindValue(v)
+	if err != nil {
+		return fmt.Errorf("form field %s: %w", name, err)
+	}
+	vals.Add(name, s)
+	return nil
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// formatBindValue is the reverse of setBindScalar.
+func formatBindValue(v reflect.Value) (string, error) {
+	switch v.Type() {
+	case timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case durationType:
+		return time.Duration(v.Int()).String(), nil
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
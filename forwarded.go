@@ -0,0 +1,123 @@
+package gserv
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+func isTrusted(tp []netip.Prefix, ip string) bool {
+	if len(tp) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, p := range tp {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedElems parses the RFC 7239 Forwarded headers into their elements, ex:
+// `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"` => [{for: 192.0.2.60, proto: http}, {for: [2001:db8::1]:4711}].
+func forwardedElems(h http.Header) (out []map[string]string) {
+	for _, v := range h.Values("Forwarded") {
+		for _, elem := range splitQuoted(v, ',') {
+			m := map[string]string{}
+			for _, pair := range splitQuoted(elem, ';') {
+				k, v, ok := strings.Cut(pair, "=")
+				if !ok {
+					continue
+				}
+				v = strings.TrimSpace(v)
+				if len(v) > 1 && v[0] == '"' && v[len(v)-1] == '"' {
+					v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+				}
+				m[strings.ToLower(strings.TrimSpace(k))] = v
+			}
+			out = append(out, m)
+		}
+	}
+	return
+}
+
+// forwardedFor returns the `for` addresses of the Forwarded headers, without ports.
+func forwardedFor(h http.Header) (out []string) {
+	for _, m := range forwardedElems(h) {
+		v, ok := m["for"]
+		if !ok {
+			continue
+		}
+
+		if strings.HasPrefix(v, "[") {
+			if i := strings.IndexByte(v, ']'); i != -1 {
+				v = v[1:i]
+			}
+		} else if i := strings.IndexByte(v, ':'); i != -1 && strings.Count(v, ":") == 1 {
+			v = v[:i]
+		}
+		out = append(out, v)
+	}
+	return
+}
+
+// forwardedParam returns the last value of param in the Forwarded headers, which is set by the closest proxy.
+func forwardedParam(h http.Header, param string) (v string) {
+	for _, m := range forwardedElems(h) {
+		if pv, ok := m[param]; ok {
+			v = pv
+		}
+	}
+	return
+}
+
+// splitQuoted splits s by sep, ignoring seps inside quoted strings, and trims the parts.
+func splitQuoted(s string, sep byte) (out []string) {
+	var inQuote, escaped bool
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && inQuote:
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			if p := strings.TrimSpace(s[last:i]); p != "" {
+				out = append(out, p)
+			}
+			last = i + 1
+		}
+	}
+	if p := strings.TrimSpace(s[last:]); p != "" {
+		out = append(out, p)
+	}
+	return
+}
+
+// splitValues splits comma separated header values, ex: X-Forwarded-For.
+func splitValues(vs []string) (out []string) {
+	for _, v := range vs {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return
+}
+
+func lastValue(v string) string {
+	if i := strings.LastIndexByte(v, ','); i != -1 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
@@ -71,14 +71,19 @@ func MsgpPatch[Req, Resp any, HandlerFn func(ctx *Context, reqBody Req) (resp Re
 }
 
 func handleOutOnly[CodecT Codec, Resp any, HandlerFn func(ctx *Context) (resp Resp, err error)](g GroupType, method, path string, handler HandlerFn, wrapResp bool) Route {
-	var c CodecT
 	var resp Resp
 	_, respBytes := any(resp).([]byte)
 
 	return g.AddRoute(method, path, func(ctx *Context) Response {
+		var ct CodecT
+		c, ok := resolveCodec(ctx, ct)
+		if !ok {
+			return RespNotAcceptable
+		}
+
 		resp, err := handler(ctx)
 		if err != nil {
-			return handleError[CodecT](ctx, err, wrapResp)
+			return handleError[CodecT](ctx, c, err, wrapResp)
 		}
 		if wrapResp {
 			return NewResponse[CodecT](resp)
@@ -87,33 +92,51 @@ func handleOutOnly[CodecT Codec, Resp any, HandlerFn func(ctx *Context) (resp Re
 			ctx.Write(any(resp).([]byte))
 			return nil
 		}
-		c.Encode(ctx, resp)
+		ctx.SetContentType(c.ContentType())
+		ctx.encode(c, 0, resp)
 		return nil
 	})
 }
 
 func handleInOut[CodecT Codec, Req, Resp any, HandlerFn func(ctx *Context, reqBody Req) (resp Resp, err error)](g GroupType, method, path string, handler HandlerFn, wrapResp bool) Route {
-	var c CodecT
+	var ct CodecT
 	var req Req
 	var resp Resp
 	_, reqBytes := any(req).([]byte)
 	_, respBytes := any(resp).([]byte)
+	_, negotiated := any(ct).(ctxCodec)
 	return g.AddRoute(method, path, func(ctx *Context) Response {
+		c, ok := resolveCodec(ctx, ct)
+		if !ok {
+			return RespNotAcceptable
+		}
+
 		var body Req
 		if reqBytes {
 			b, err := io.ReadAll(ctx.Req.Body)
 			if err != nil {
-				return handleError[CodecT](ctx, err, wrapResp)
+				return handleError[CodecT](ctx, c, err, wrapResp)
 			}
 			*(any(&body).(*[]byte)) = b
-		} else if err := c.Decode(ctx.Req.Body, &body); err != nil && !errors.Is(err, io.EOF) {
-			return handleError[CodecT](ctx, err, wrapResp)
+		} else {
+			var err error
+			if negotiated { // decode based on the request's content-type
+				err = ctx.decodeBody(&body)
+			} else {
+				err = ct.Decode(ctx.Req.Body, &body)
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return handleError[CodecT](ctx, c, err, wrapResp)
+			}
+			if err := Validate(&body); err != nil {
+				return handleError[CodecT](ctx, c, err, wrapResp)
+			}
 		}
 
 		ctx.SetContentType(c.ContentType())
 		resp, err := handler(ctx, body)
 		if err != nil {
-			return handleError[CodecT](ctx, err, wrapResp)
+			return handleError[CodecT](ctx, c, err, wrapResp)
 		}
 		if wrapResp {
 			return NewResponse[CodecT](resp)
@@ -122,18 +145,25 @@ func handleInOut[CodecT Codec, Req, Resp any, HandlerFn func(ctx *Context, reqBo
 			ctx.Write(any(resp).([]byte))
 			return nil
 		}
-		c.Encode(ctx, resp)
+		ctx.encode(c, 0, resp)
 		return nil
 	})
 }
 
-func handleError[C Codec](ctx *Context, e error, wrapResp bool) Response {
-	var c C
+// handleError returns an error response, c is the resolved CodecT.
+func handleError[C Codec](ctx *Context, c Codec, e error, wrapResp bool) Response {
 	err := getError(e)
 	if wrapResp {
+		if me, ok := e.(MultiError); ok { // list each error, ex: from BindRequest
+			return NewErrorResponse[C](err.Status(), me)
+		}
 		return NewErrorResponse[C](err.Status(), err)
 	}
-	ctx.WriteHeader(err.Status())
-	c.Encode(ctx, getError(err))
+	var out any = err
+	if me, ok := e.(MultiError); ok { // keep each error, ex: the fields that failed Validate
+		out = NewErrorResponse[C](err.Status(), me).Errors
+	}
+	ctx.SetContentType(c.ContentType())
+	ctx.encode(c, err.Status(), out)
 	return nil
 }
@@ -43,10 +43,11 @@ func NewErrorResponse[CodecT Codec](code int, errs ...any) (r *GenResponse[Codec
 
 // GenResponse is the default standard api response
 type GenResponse[CodecT Codec] struct {
-	Data    any     `json:"data,omitempty"`
-	Errors  []Error `json:"errors,omitempty"`
-	Code    int     `json:"code"`
-	Success bool    `json:"success"`
+	Data      any     `json:"data,omitempty"`
+	Errors    []Error `json:"errors,omitempty"`
+	Code      int     `json:"code"`
+	Success   bool    `json:"success"`
+	RequestID string  `json:"requestID,omitempty"` // set on error responses if the request has an id, see RequestID
 }
 
 func (r GenResponse[CodecT]) Status() int {
@@ -76,12 +77,19 @@ func (r GenResponse[CodecT]) WriteToCtx(ctx *Context) error {
 	}
 
 	r.Success = r.Code >= http.StatusOK && r.Code < http.StatusBadRequest
+	if !r.Success && r.RequestID == "" {
+		r.RequestID = ctx.reqID
+	}
 
-	var c CodecT
-	ctx.SetContentType(c.ContentType())
-	ctx.WriteHeader(r.Code)
+	var ct CodecT
+	c, ok := resolveCodec(ctx, ct)
+	if !ok {
+		RespNotAcceptable.WriteToCtx(ctx)
+		return ErrNotAcceptable
+	}
 
-	return c.Encode(ctx, &r)
+	ctx.SetContentType(c.ContentType())
+	return ctx.encode(c, r.Code, &r)
 }
 
 func (r GenResponse[CodecT]) Cached() Response {
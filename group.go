@@ -1,10 +1,13 @@
 package gserv
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"go.oneofone.dev/gserv/router"
+	"go.oneofone.dev/gserv/trace"
 	"go.oneofone.dev/oerrs"
 )
 
@@ -20,6 +23,7 @@ type Handler = func(ctx *Context) Response
 
 type Group struct {
 	s    *Server
+	r    *router.Router
 	nm   string
 	path string
 	mw   []Handler
@@ -30,21 +34,65 @@ func (g *Group) Use(mw ...Handler) {
 	g.mw = append(g.mw, mw...)
 }
 
-// Routes returns the current routes set.
+// RouteInfo describes a route added to a group.
+type RouteInfo struct {
+	router.RouteInfo
+	Middleware []string `json:"middleware,omitempty"` // the group's middleware, in the order they run
+	Handlers   []string `json:"handlers,omitempty"`
+}
+
+// Routes returns the group's routes, the server returns all the routes of its host.
 // Each route is returned in the order of group name, method, path.
 func (g *Group) Routes() [][3]string {
-	return g.s.r.GetRoutes()
+	ris := g.RoutesInfo()
+	out := make([][3]string, 0, len(ris))
+	for _, ri := range ris {
+		out = append(out, [3]string{ri.Group, ri.Method, ri.Path})
+	}
+	return out
+}
+
+// RoutesInfo returns the info of the group's routes, the server returns all the routes of its host.
+// A route belongs to a group if it has the same name, and its path is under the group's path.
+func (g *Group) RoutesInfo() []RouteInfo {
+	var out []RouteInfo
+	for _, rn := range g.r.Routes() {
+		if !g.owns(rn) {
+			continue
+		}
+
+		ri := RouteInfo{RouteInfo: rn.Info()}
+		if v, ok := g.s.chains.Load(rn); ok {
+			ghc := v.(*groupHandlerChain)
+			ri.Middleware = funcNames(ghc.g.mw)
+			ri.Handlers = funcNames(ghc.hc)
+		}
+		out = append(out, ri)
+	}
+	return out
 }
 
-// AddRoute adds a handler (or more) to the specific method and path
-// it is NOT safe to call this once you call one of the run functions
+func (g *Group) owns(rn Route) bool {
+	if g == &g.s.Group {
+		return true
+	}
+	return rn.Group() == g.nm && strings.HasPrefix(rn.Path(), g.path)
+}
+
+// AddRoute adds a handler (or more) to the specific method and path,
+// method can be any valid http token, ex: PROPFIND or MKCOL for WebDAV.
+// It's safe to call while the server is running.
 func (g *Group) AddRoute(method, path string, handlers ...Handler) Route {
 	ghc := groupHandlerChain{
 		hc: handlers,
 		g:  g,
 	}
 	p := joinPath(g.path, path)
-	return g.s.r.AddRoute(g.nm, method, p, ghc.Serve)
+	rn := g.r.AddRoute(g.nm, method, p, ghc.Serve)
+	if rn != nil {
+		g.s.chains.Store(rn, &ghc)
+	}
+	return rn
 }
 
 // GET is an alias for AddRoute("GET", path, handlers...).
@@ -72,8 +120,31 @@ func (g *Group) OPTIONS(path string, handlers ...Handler) Route {
 	return g.AddRoute(http.MethodOptions, path, handlers...)
 }
 
+// RemoveRoute removes a route added with AddRoute, path is relative to the group like in AddRoute.
+// It's safe to call while the server is running, returns false if the route doesn't exist.
+func (g *Group) RemoveRoute(method, path string) bool {
+	p := joinPath(g.path, path)
+
+	var rn Route
+	for _, o := range g.r.Routes() {
+		if o.Method() == method && o.Path() == p {
+			rn = o
+			break
+		}
+	}
+
+	if !g.r.RemoveRoute(method, p) {
+		return false
+	}
+
+	if rn != nil {
+		g.s.chains.Delete(rn)
+	}
+	return true
+}
+
 func (g *Group) DisableRoute(method, path string, disabled bool) bool {
-	return g.s.r.DisableRoute(method, joinPath(g.path, path), disabled)
+	return g.r.DisableRoute(method, joinPath(g.path, path), disabled)
 }
 
 func (g *Group) Static(path, localPath string, allowListing bool) Route {
@@ -89,6 +160,41 @@ func (g *Group) StaticFile(path, localPath string) Route {
 	})
 }
 
+// Mount serves h under prefix/*rest for any method that doesn't have its own route for the path,
+// after running the group's middleware, ex:
+//
+//	g.Mount("/debug/pprof", http.DefaultServeMux)
+//	g.Mount("/admin", adminServer)
+//
+// h gets a copy of the request with the prefix stripped from the path, and X-Forwarded-Prefix set to the stripped prefix,
+// appended to the X-Forwarded-Prefix of an outer Mount, or of the request if it comes from one of Options.TrustedProxies.
+func (g *Group) Mount(prefix string, h http.Handler) Route {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return g.AddRoute(router.MethodAny, joinPath(prefix, "*rest"), func(ctx *Context) Response {
+		req := ctx.Req
+		rest := ctx.Param("rest")
+
+		u := *req.URL
+		u.Path, u.RawPath = "/"+rest, ""
+		mounted := strings.TrimSuffix(strings.TrimSuffix(req.URL.Path, rest), "/")
+
+		base, ok := req.Context().Value(mountPrefixCtxKey{}).(string)
+		if !ok && ctx.fromTrustedProxy() {
+			base = req.Header.Get("X-Forwarded-Prefix")
+		}
+		mounted = base + mounted
+
+		r2 := req.Clone(context.WithValue(req.Context(), mountPrefixCtxKey{}, mounted))
+		r2.URL = &u
+		r2.Header.Set("X-Forwarded-Prefix", mounted)
+
+		h.ServeHTTP(ctx, r2)
+		return nil
+	})
+}
+
+type mountPrefixCtxKey struct{}
+
 // SubGroup returns a sub-handler group based on the current group's middleware
 func (g *Group) SubGroup(name, path string, mw ...Handler) *Group {
 	return &Group{
@@ -96,6 +202,7 @@ func (g *Group) SubGroup(name, path string, mw ...Handler) *Group {
 		mw:   append(g.mw[:len(g.mw):len(g.mw)], mw...),
 		path: joinPath(g.path, path),
 		s:    g.s,
+		r:    g.r,
 	}
 }
 
@@ -125,21 +232,33 @@ func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p
 
 		mwIdx, hIdx int
 
-		catchPanic func()
+		catchPanic func(ctx *Context)
 	)
 	defer putCtx(ctx)
 
+	if ri := router.RequestInfoFromRequest(req); ri != nil {
+		defer func() {
+			ri.Status, ri.BytesWritten, ri.Panicked = ctx.Status(), int64(ctx.BytesWritten()), ctx.panicked
+		}()
+	}
+
+	// the chain funcs use the ctx they're called with rather than the one above,
+	// so middleware like Timeout can continue the chain with a copy of it.
 	if ph := ghc.g.s.PanicHandler; ph != nil {
-		catchPanic = func() {
+		catchPanic = func(ctx *Context) {
 			if v := recover(); v != nil {
 				fr := oerrs.Caller(2)
+				if span := trace.SpanFromContext(ctx.Req.Context()); span != nil {
+					span.RecordPanic(v, fmt.Sprintf("%s\n\t%s:%d", fr.Function, fr.File, fr.Line))
+				}
 				ghc.g.s.PanicHandler(ctx, v, fr)
+				ctx.panicked = true
 			}
 		}
 	}
-	ctx.nextMW = func() {
+	ctx.nextMW = func(ctx *Context) {
 		if catchPanic != nil {
-			defer catchPanic()
+			defer catchPanic(ctx)
 		}
 		for mwIdx < len(ghc.g.mw) && !ctx.done {
 			h := ghc.g.mw[mwIdx]
@@ -156,9 +275,9 @@ func (ghc *groupHandlerChain) Serve(rw http.ResponseWriter, req *http.Request, p
 		ctx.nextMW = nil
 	}
 
-	ctx.next = func() {
+	ctx.next = func(ctx *Context) {
 		if catchPanic != nil {
-			defer catchPanic()
+			defer catchPanic(ctx)
 		}
 		for hIdx < len(ghc.hc) && !ctx.done {
 			h := ghc.hc[hIdx]
@@ -0,0 +1,158 @@
+package gserv
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// AsyncWriter buffers writes and writes them to the underlying writer from a background goroutine,
+// so slow disks don't add latency to requests.
+type AsyncWriter struct {
+	w    io.Writer
+	ch   chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+// NewAsyncWriter returns an AsyncWriter that queues up to queueSize writes, once the queue is full, writes block.
+// Close must be called to flush the pending writes.
+func NewAsyncWriter(w io.Writer, queueSize int) *AsyncWriter {
+	if queueSize < 1 {
+		queueSize = 1024
+	}
+
+	aw := &AsyncWriter{
+		w:    w,
+		ch:   make(chan []byte, queueSize),
+		done: make(chan struct{}),
+	}
+	go aw.process()
+	return aw
+}
+
+// Write queues a copy of p, it always succeeds, write errors of the underlying writer are ignored.
+// It must not be called after Close.
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	aw.ch <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func (aw *AsyncWriter) process() {
+	defer close(aw.done)
+
+	bw := bufio.NewWriterSize(aw.w, 64*1024)
+	for p := range aw.ch {
+		bw.Write(p)
+		if len(aw.ch) == 0 {
+			bw.Flush()
+		}
+	}
+	bw.Flush()
+}
+
+// Close flushes the pending writes and closes the underlying writer if it's an io.Closer.
+func (aw *AsyncWriter) Close() (err error) {
+	aw.once.Do(func() {
+		close(aw.ch)
+		<-aw.done
+		if c, ok := aw.w.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+	return
+}
+
+// LogFile is an append-only file that's reopened on SIGHUP, so it works with logrotate and similar tools.
+type LogFile struct {
+	path string
+
+	mux sync.Mutex
+	f   *os.File
+
+	sig  chan os.Signal
+	done chan struct{}
+}
+
+// OpenLogFile opens (or creates) the file at path for appending and reopens it every time the process receives SIGHUP.
+func OpenLogFile(path string) (*LogFile, error) {
+	f, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lf := &LogFile{
+		path: path,
+		f:    f,
+		sig:  make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+
+	signal.Notify(lf.sig, syscall.SIGHUP)
+	go lf.watch()
+	return lf, nil
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
+
+func (lf *LogFile) watch() {
+	for {
+		select {
+		case <-lf.sig:
+			lf.Reopen()
+		case <-lf.done:
+			return
+		}
+	}
+}
+
+// Reopen closes and reopens the file, it's called on SIGHUP.
+// If the file can't be opened, the old one is kept.
+func (lf *LogFile) Reopen() error {
+	f, err := openLogFile(lf.path)
+	if err != nil {
+		return err
+	}
+
+	lf.mux.Lock()
+	old := lf.f
+	if old != nil {
+		lf.f = f
+	}
+	lf.mux.Unlock()
+
+	if old == nil { // closed
+		f.Close()
+		return os.ErrClosed
+	}
+	return old.Close()
+}
+
+func (lf *LogFile) Write(p []byte) (int, error) {
+	lf.mux.Lock()
+	defer lf.mux.Unlock()
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+	return lf.f.Write(p)
+}
+
+// Close stops watching for SIGHUP and closes the file.
+func (lf *LogFile) Close() error {
+	lf.mux.Lock()
+	defer lf.mux.Unlock()
+	if lf.f == nil {
+		return os.ErrClosed
+	}
+
+	signal.Stop(lf.sig)
+	close(lf.done)
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
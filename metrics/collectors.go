@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// labels is used as a map key, so it's a fixed size struct, unused labels are empty.
+type labels [4]string
+
+type counterVec struct {
+	mux  sync.RWMutex
+	name string
+	help string
+	keys []string
+	m    map[labels]*atomic.Uint64
+}
+
+func newCounterVec(name, help string, keys ...string) *counterVec {
+	return &counterVec{name: name, help: help, keys: keys, m: map[labels]*atomic.Uint64{}}
+}
+
+func (c *counterVec) get(ls labels) *atomic.Uint64 {
+	c.mux.RLock()
+	v := c.m[ls]
+	c.mux.RUnlock()
+	if v != nil {
+		return v
+	}
+
+	c.mux.Lock()
+	if v = c.m[ls]; v == nil {
+		v = new(atomic.Uint64)
+		c.m[ls] = v
+	}
+	c.mux.Unlock()
+	return v
+}
+
+func (c *counterVec) inc(ls labels) { c.get(ls).Add(1) }
+
+func (c *counterVec) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	for _, ls := range sortedKeys(c.m) {
+		writeSample(w, c.name, c.keys, ls, "", "", strconv.FormatUint(c.m[ls].Load(), 10))
+	}
+}
+
+type gaugeVec struct {
+	mux  sync.RWMutex
+	name string
+	help string
+	keys []string
+	m    map[labels]*atomic.Int64
+}
+
+func newGaugeVec(name, help string, keys ...string) *gaugeVec {
+	return &gaugeVec{name: name, help: help, keys: keys, m: map[labels]*atomic.Int64{}}
+}
+
+func (g *gaugeVec) get(ls labels) *atomic.Int64 {
+	g.mux.RLock()
+	v := g.m[ls]
+	g.mux.RUnlock()
+	if v != nil {
+		return v
+	}
+
+	g.mux.Lock()
+	if v = g.m[ls]; v == nil {
+		v = new(atomic.Int64)
+		g.m[ls] = v
+	}
+	g.mux.Unlock()
+	return v
+}
+
+func (g *gaugeVec) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	g.mux.RLock()
+	defer g.mux.RUnlock()
+	for _, ls := range sortedKeys(g.m) {
+		writeSample(w, g.name, g.keys, ls, "", "", strconv.FormatInt(g.m[ls].Load(), 10))
+	}
+}
+
+type histogram struct {
+	counts []atomic.Uint64 // one per bucket, +Inf is count
+	count  atomic.Uint64
+	sum    atomic.Uint64 // float64 bits
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if i := sort.SearchFloat64s(buckets, v); i < len(buckets) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+type histogramVec struct {
+	mux     sync.RWMutex
+	name    string
+	help    string
+	keys    []string
+	buckets []float64
+	m       map[labels]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, keys ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, keys: keys, buckets: buckets, m: map[labels]*histogram{}}
+}
+
+func (h *histogramVec) observe(ls labels, v float64) {
+	h.mux.RLock()
+	hist := h.m[ls]
+	h.mux.RUnlock()
+
+	if hist == nil {
+		h.mux.Lock()
+		if hist = h.m[ls]; hist == nil {
+			hist = &histogram{counts: make([]atomic.Uint64, len(h.buckets))}
+			h.m[ls] = hist
+		}
+		h.mux.Unlock()
+	}
+
+	hist.observe(h.buckets, v)
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	for _, ls := range sortedKeys(h.m) {
+		hist := h.m[ls]
+		var cum uint64
+		for i, b := range h.buckets {
+			cum += hist.counts[i].Load()
+			writeSample(w, h.name+"_bucket", h.keys, ls, "le", formatFloat(b), strconv.FormatUint(cum, 10))
+		}
+		count := strconv.FormatUint(hist.count.Load(), 10)
+		writeSample(w, h.name+"_bucket", h.keys, ls, "le", "+Inf", count)
+		writeSample(w, h.name+"_sum", h.keys, ls, "", "", formatFloat(math.Float64frombits(hist.sum.Load())))
+		writeSample(w, h.name+"_count", h.keys, ls, "", "", count)
+	}
+}
+
+func sortedKeys[V any](m map[labels]V) []labels {
+	out := make([]labels, 0, len(m))
+	for ls := range m {
+		out = append(out, ls)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return out
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	io.WriteString(w, "# HELP "+name+" "+help+"\n# TYPE "+name+" "+typ+"\n")
+}
+
+// writeSample writes a sample in the text exposition format, extraKey is used for the histogram's `le` label.
+func writeSample(w io.Writer, name string, keys []string, ls labels, extraKey, extraVal, value string) {
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(keys) > 0 || extraKey != "" {
+		sb.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(k + `="` + escapeLabel(ls[i]) + `"`)
+		}
+		if extraKey != "" {
+			if len(keys) > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(extraKey + `="` + extraVal + `"`)
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteString(" " + value + "\n")
+	io.WriteString(w, sb.String())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
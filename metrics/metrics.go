@@ -0,0 +1,168 @@
+// Package metrics records gserv request metrics and exposes them in the Prometheus text exposition format,
+// without depending on the Prometheus client, ex:
+//
+//	m := metrics.New()
+//	srv.Use(m.Middleware())
+//	srv.GET("/metrics", gserv.HTTPHandler(m))
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.oneofone.dev/gserv"
+	"go.oneofone.dev/gserv/router"
+)
+
+var (
+	// DefaultDurationBuckets are the request duration histogram buckets, in seconds.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are the response size histogram buckets, in bytes.
+	DefaultSizeBuckets = []float64{100, 1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20}
+)
+
+// ClientCounter is implemented by sse.Router.
+type ClientCounter interface {
+	Clients() int
+}
+
+// Metrics holds the recorded metrics, it implements http.Handler to expose them.
+type Metrics struct {
+	requests *counterVec
+	duration *histogramVec
+	size     *histogramVec
+	inFlight *gaugeVec
+	cache    *counterVec
+
+	mux     sync.RWMutex
+	streams map[string]ClientCounter
+}
+
+// New returns a new Metrics using DefaultDurationBuckets and DefaultSizeBuckets.
+func New() *Metrics {
+	reqKeys := []string{"group", "method", "route", "status"}
+	return &Metrics{
+		requests: newCounterVec("gserv_http_requests_total", "Total number of HTTP requests.", reqKeys...),
+		duration: newHistogramVec("gserv_http_request_duration_seconds", "HTTP request latency in seconds.",
+			DefaultDurationBuckets, reqKeys...),
+		size: newHistogramVec("gserv_http_response_size_bytes", "HTTP response body size in bytes.",
+			DefaultSizeBuckets, reqKeys...),
+		inFlight: newGaugeVec("gserv_http_requests_in_flight", "Number of HTTP requests currently being served.",
+			"group", "method", "route"),
+		cache: newCounterVec("gserv_cache_requests_total", "Total number of CacheHandler lookups.",
+			"group", "method", "route", "result"),
+
+		streams: map[string]ClientCounter{},
+	}
+}
+
+// Middleware returns a middleware that records the metrics of the requests it handles,
+// it should be added before any sub groups are created, so they inherit it.
+func (m *Metrics) Middleware() gserv.Handler {
+	return func(ctx *gserv.Context) gserv.Response {
+		var (
+			start = time.Now()
+			ls    labels
+		)
+
+		if rn := ctx.Route(); rn != nil {
+			ls = labels{rn.Group(), methodLabel(rn, ctx.Req.Method), rn.Path()}
+		} else {
+			ls = labels{"", methodLabel(nil, ctx.Req.Method), ""}
+		}
+
+		inFlight := m.inFlight.get(ls)
+		inFlight.Add(1)
+
+		defer func() {
+			inFlight.Add(-1)
+
+			if v, ok := ctx.Get(gserv.CacheStatusKey).(string); ok {
+				cls := ls
+				cls[3] = v
+				m.cache.inc(cls)
+			}
+
+			ls[3] = statusClass(ctx.Status())
+			m.requests.inc(ls)
+			m.duration.observe(ls, time.Since(start).Seconds())
+			m.size.observe(ls, float64(ctx.BytesWritten()))
+		}()
+
+		ctx.NextMiddleware()
+		ctx.Next()
+		return nil
+	}
+}
+
+// methodLabel returns method if it's a standard method or the one rn was registered with,
+// anything else is "OTHER", since clients can send any method to router.MethodAny routes, ex: gserv.Mount.
+func methodLabel(rn *router.Route, method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	if rn != nil && rn.Method() == method {
+		return method
+	}
+	return "OTHER"
+}
+
+// TrackSSE exposes the number of clients connected to r, labeled by name.
+func (m *Metrics) TrackSSE(name string, r ClientCounter) {
+	m.mux.Lock()
+	m.streams[name] = r
+	m.mux.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var buf bytes.Buffer
+	m.requests.write(&buf)
+	m.duration.write(&buf)
+	m.size.write(&buf)
+	m.inFlight.write(&buf)
+	m.cache.write(&buf)
+	m.writeStreams(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func (m *Metrics) writeStreams(buf *bytes.Buffer) {
+	const name = "gserv_sse_clients"
+	writeHeader(buf, name, "Number of connected SSE clients.", "gauge")
+
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	names := make([]string, 0, len(m.streams))
+	for n := range m.streams {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		writeSample(buf, name, []string{"stream"}, labels{n}, "", "", strconv.Itoa(m.streams[n].Clients()))
+	}
+}
+
+func statusClass(code int) string {
+	switch {
+	case code < 200:
+		return "1xx"
+	case code < 300:
+		return "2xx"
+	case code < 400:
+		return "3xx"
+	case code < 500:
+		return "4xx"
+	default:
+		return "5xx"
+	}
+}
@@ -0,0 +1,68 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.oneofone.dev/gserv"
+	"go.oneofone.dev/gserv/metrics"
+)
+
+type clients int
+
+func (c clients) Clients() int { return int(c) }
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	m.TrackSSE("events", clients(3))
+
+	srv := gserv.New(gserv.SetErrLogger(nil))
+	srv.Use(m.Middleware())
+	srv.GET("/metrics", gserv.HTTPHandler(m))
+
+	api := srv.SubGroup("api", "/api")
+	api.GET("/users/:id", func(ctx *gserv.Context) gserv.Response {
+		return gserv.NewJSONResponse(ctx.Param("id"))
+	})
+	api.GET("/cached", gserv.CacheHandler(func(ctx *gserv.Context) string { return "tag" }, time.Minute, func(ctx *gserv.Context) gserv.Response {
+		return gserv.NewJSONResponse("cached")
+	}))
+
+	srv.Mount("/files", http.FileServer(http.Dir(t.TempDir())))
+	srv.AddRoute("PURGE", "/cache", func(ctx *gserv.Context) gserv.Response { return gserv.RespOK })
+
+	for _, p := range []string{"/api/users/1", "/api/users/2", "/api/users/abc", "/api/cached", "/api/cached"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+	for _, m := range []string{"FOO1", "FOO2", "PROPFIND"} { // any method reaches a Mount
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(m, "/files/x", nil))
+	}
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/cache", nil))
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rr.Body.String()
+
+	for _, exp := range []string{
+		"# TYPE gserv_http_requests_total counter\n",
+		`gserv_http_requests_total{group="api",method="GET",route="/api/users/:id",status="2xx"} 3` + "\n",
+		`gserv_http_request_duration_seconds_count{group="api",method="GET",route="/api/users/:id",status="2xx"} 3` + "\n",
+		`gserv_http_response_size_bytes_bucket{group="api",method="GET",route="/api/users/:id",status="2xx",le="+Inf"} 3` + "\n",
+		`gserv_http_requests_in_flight{group="",method="GET",route="/metrics"} 1` + "\n",
+		`gserv_cache_requests_total{group="api",method="GET",route="/api/cached",result="hit"} 1` + "\n",
+		`gserv_cache_requests_total{group="api",method="GET",route="/api/cached",result="miss"} 1` + "\n",
+		`gserv_sse_clients{stream="events"} 3` + "\n",
+		`gserv_http_requests_total{group="",method="OTHER",route="/files/*rest",status="4xx"} 3` + "\n",
+		`gserv_http_requests_total{group="",method="PURGE",route="/cache",status="2xx"} 1` + "\n",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("missing %q in:\n%s", exp, out)
+		}
+	}
+	if strings.Contains(out, "FOO") {
+		t.Errorf("unexpected custom method label in:\n%s", out)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"sync/atomic"
 	"time"
@@ -16,6 +17,8 @@ var reqID uint64
 
 // LogRequests is a request logger middleware.
 // If logJSONRequests is true, it'll attempt to parse the incoming request's body and output it to the log.
+// If the server has a structured logger, the request is logged with attributes using Context.Logger.
+// See AccessLog for configurable formats.
 func LogRequests(logJSONRequests bool) Handler {
 	return func(ctx *Context) Response {
 		var (
@@ -23,7 +26,10 @@ func LogRequests(logJSONRequests bool) Handler {
 			url   = req.URL
 			start = time.Now()
 			id    = atomic.AddUint64(&reqID, 1)
-			extra string
+			sl    = ctx.s.opts.SLogger != nil
+
+			extra   string
+			reqBody []slog.Attr
 		)
 
 		if logJSONRequests {
@@ -35,11 +41,16 @@ func LogRequests(logJSONRequests bool) Handler {
 				req.Body = io.NopCloser(&buf)
 				j, _ := internal.Marshal(req.Header)
 				if ln := buf.Len(); ln > 0 {
+					body := "<binary>"
 					switch buf.Bytes()[0] {
 					case '[', '{', 'n': // [], {} and nullable
-						extra = fmt.Sprintf("\n\tHeaders: %s\n\tRequest (%d): %s", j, ln, buf.String())
-					default:
-						extra = fmt.Sprintf("\n\tHeaders: %s\n\tRequest (%d): <binary>", j, buf.Len())
+						body = buf.String()
+					}
+
+					if sl {
+						reqBody = []slog.Attr{slog.String("headers", string(j)), slog.Int("requestBytes", ln), slog.String("request", body)}
+					} else {
+						extra = fmt.Sprintf("\n\tHeaders: %s\n\tRequest (%d): %s", j, ln, body)
 					}
 				}
 			}
@@ -50,6 +61,19 @@ func LogRequests(logJSONRequests bool) Handler {
 
 		ct := req.Header.Get("Content-Type")
 
+		if sl {
+			attrs := append([]slog.Attr{
+				slog.Int("status", ctx.Status()),
+				slog.String("path", url.Path),
+				slog.Duration("duration", time.Since(start)),
+				slog.Int("bytes", ctx.BytesWritten()),
+				slog.String("userAgent", req.UserAgent()),
+				slog.String("contentType", ct),
+			}, reqBody...)
+			ctx.Logger().LogAttrs(req.Context(), slog.LevelInfo, "request", attrs...)
+			return nil
+		}
+
 		switch ct {
 		case MimeJSON:
 			ct = "[JSON] "
@@ -62,8 +86,14 @@ func LogRequests(logJSONRequests bool) Handler {
 			ct = "[" + ct + "] "
 		}
 
-		ctx.LogSkipf(1, "[reqID:%05d] [%s] [%s] %s[%d] %s %s [%s]%s",
-			id, ctx.ClientIP(), req.UserAgent(), ct, ctx.Status(), req.Method, url.Path, time.Since(start), extra)
+		// the counter is only used to tell the log lines apart, it's not the request's id, see RequestID
+		logID := ctx.reqID
+		if logID == "" {
+			logID = fmt.Sprintf("%05d", id)
+		}
+
+		ctx.LogSkipf(1, "[reqID:%s] [%s] [%s] %s[%d] %s %s [%s]%s",
+			logID, ctx.ClientIP(), req.UserAgent(), ct, ctx.Status(), req.Method, url.Path, time.Since(start), extra)
 		return nil
 	}
 }
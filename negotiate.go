@@ -0,0 +1,342 @@
+package gserv
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MediaRange is a parsed element of an Accept header.
+type MediaRange struct {
+	Type   string // ex: application/json, text/*, */*
+	Q      float64
+	Params map[string]string // without q
+}
+
+// ParseAccept parses an Accept header, the ranges are sorted by q-value, then by specificity.
+// Invalid ranges are skipped.
+func ParseAccept(h string) []MediaRange {
+	var out []MediaRange
+	for _, part := range strings.Split(h, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		typ, params, err := mime.ParseMediaType(part)
+		if err != nil || strings.IndexByte(typ, '/') == -1 {
+			continue
+		}
+
+		mr := MediaRange{Type: typ, Q: 1}
+		if q, ok := params["q"]; ok {
+			if mr.Q, err = strconv.ParseFloat(q, 64); err != nil || mr.Q < 0 || mr.Q > 1 {
+				continue
+			}
+			delete(params, "q")
+		}
+		if len(params) > 0 {
+			mr.Params = params
+		}
+		out = append(out, mr)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := &out[i], &out[j]
+		if a.Q != b.Q {
+			return a.Q > b.Q
+		}
+		return a.specificity() > b.specificity()
+	})
+	return out
+}
+
+func (mr *MediaRange) specificity() int {
+	switch {
+	case mr.Type == "*/*":
+		return 0
+	case strings.HasSuffix(mr.Type, "/*"):
+		return 1
+	default:
+		return 2 + len(mr.Params)
+	}
+}
+
+// Matches returns true if typ (ex: application/json) is in the range.
+func (mr *MediaRange) Matches(typ string) bool {
+	switch {
+	case mr.Type == "*/*", mr.Type == typ:
+		return true
+	case strings.HasSuffix(mr.Type, "/*"):
+		return strings.HasPrefix(typ, mr.Type[:len(mr.Type)-1])
+	}
+	return false
+}
+
+type registeredCodec struct {
+	mediaType string
+	c         Codec
+	negotiate bool // used to encode responses, see RegisterCodec
+}
+
+var codecs struct {
+	mux  sync.RWMutex
+	list []registeredCodec // in order of preference
+}
+
+func init() {
+	codecs.list = []registeredCodec{
+		{MimeJSON, JSONCodec{}, true},
+		{MimeMsgPack, MsgpCodec{}, true},
+		{MimeCBOR, CBORCodec{}, true},
+		// decode-only by default: browsers accept application/xml, and neither can encode any value, ex: maps
+		{MimeXML, XMLCodec{}, false},
+		{MimeForm, FormCodec{}, false},
+	}
+}
+
+// RegisterCodec registers c for mediaType, ex: application/json, replacing any codec already registered for it.
+// Registered codecs are used to decode requests based on their Content-Type, see Context.Bind,
+// and to encode responses based on their Accept header, see Context.Negotiate,
+// new media types have the lowest preference when multiple codecs are equally acceptable.
+// XMLCodec and FormCodec are only used to decode requests unless they're registered explicitly, ex:
+//
+//	gserv.RegisterCodec(gserv.MimeXML, gserv.XMLCodec{})
+//
+// It panics if mediaType isn't a valid media type, or c is nil.
+func RegisterCodec(mediaType string, c Codec) {
+	mt, _, err := mime.ParseMediaType(mediaType)
+	if err != nil || strings.IndexByte(mt, '/') == -1 || strings.IndexByte(mt, '*') != -1 {
+		panic(fmt.Sprintf("gserv: invalid codec media type %q", mediaType))
+	}
+	if c == nil {
+		panic("gserv: RegisterCodec called with a nil codec")
+	}
+
+	codecs.mux.Lock()
+	defer codecs.mux.Unlock()
+	for i := range codecs.list {
+		if codecs.list[i].mediaType == mt {
+			codecs.list[i].c, codecs.list[i].negotiate = c, true
+			return
+		}
+	}
+	codecs.list = append(codecs.list, registeredCodec{mt, c, true})
+}
+
+// codecFor returns the registered codec for mediaType, ex: application/json.
+func codecFor(mediaType string) Codec {
+	if rc := registered(mediaType); rc != nil {
+		return rc.c
+	}
+	return nil
+}
+
+func registered(mediaType string) *registeredCodec {
+	codecs.mux.RLock()
+	defer codecs.mux.RUnlock()
+	for i := range codecs.list {
+		if codecs.list[i].mediaType == mediaType {
+			rc := codecs.list[i]
+			return &rc
+		}
+	}
+	return nil
+}
+
+// contentTypeCodec returns the registered codec for a Content-Type header value,
+// types like application/problem+json, text/xml or application/x-msgpack match on their subtype.
+func contentTypeCodec(ct string) Codec {
+	if rc := contentTypeRegistered(ct); rc != nil {
+		return rc.c
+	}
+	return nil
+}
+
+// responseCodec returns contentTypeCodec(ct) if it's used to encode responses, see RegisterCodec.
+func responseCodec(ct string) Codec {
+	if rc := contentTypeRegistered(ct); rc != nil && rc.negotiate {
+		return rc.c
+	}
+	return nil
+}
+
+func contentTypeRegistered(ct string) *registeredCodec {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil
+	}
+	if rc := registered(mt); rc != nil {
+		return rc
+	}
+
+	codecs.mux.RLock()
+	defer codecs.mux.RUnlock()
+	for _, rc := range codecs.list {
+		if _, sub, _ := strings.Cut(rc.mediaType, "/"); strings.Contains(mt, sub) {
+			return &rc
+		}
+	}
+	return nil
+}
+
+// NegotiateCodec returns the registered codec that best matches the Accept header value,
+// if multiple codecs are equally acceptable, the first registered one wins.
+// If accept is empty, def is returned.
+func NegotiateCodec(accept string, def Codec) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return def, true
+	}
+
+	ranges := ParseAccept(accept)
+
+	codecs.mux.RLock()
+	defer codecs.mux.RUnlock()
+
+	var (
+		best  Codec
+		bestQ float64
+	)
+	for _, rc := range codecs.list {
+		if !rc.negotiate {
+			continue
+		}
+		// the most specific matching range decides the codec's q-value
+		q, spec := 0.0, -1
+		for i := range ranges {
+			mr := &ranges[i]
+			if s := mr.specificity(); s > spec && mr.Matches(rc.mediaType) {
+				q, spec = mr.Q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = rc.c, q
+		}
+	}
+
+	if best == nil {
+		return nil, false
+	}
+
+	// keep the default's options, ex: JSONCodec.Indent
+	if def != nil && def.ContentType() == best.ContentType() {
+		return def, true
+	}
+	return best, true
+}
+
+// acceptedCodec returns the registered codec of the most acceptable media type explicitly named by accept,
+// wildcard ranges are ignored. def is preferred if it's just as acceptable, and returned if nothing matches.
+func acceptedCodec(accept string, def Codec) Codec {
+	var (
+		best  Codec
+		bestQ float64
+	)
+	for _, mr := range ParseAccept(accept) { // sorted by q-value
+		if mr.Q == 0 || mr.Q < bestQ || mr.specificity() < 2 {
+			continue
+		}
+		rc := registered(mr.Type)
+		if rc == nil || !rc.negotiate {
+			continue
+		}
+		if def != nil && rc.c.ContentType() == def.ContentType() {
+			return def
+		}
+		if best == nil {
+			best, bestQ = rc.c, mr.Q
+		}
+	}
+
+	if best == nil {
+		return def
+	}
+	return best
+}
+
+// Negotiate encodes v using the codec that best matches the request's Accept header, see NegotiateCodec,
+// it falls back to ctx.Codec or DefaultCodec if there's no Accept header,
+// and responds with RespNotAcceptable and returns ErrNotAcceptable if no codec matches.
+// calling this function marks the Context as done, meaning any returned responses won't be written out.
+func (ctx *Context) Negotiate(code int, v any) error {
+	c, ok := ctx.negotiateCodec()
+	if !ok {
+		RespNotAcceptable.WriteToCtx(ctx)
+		ctx.done = true
+		return ErrNotAcceptable
+	}
+	return ctx.EncodeCodec(c, code, v)
+}
+
+func (ctx *Context) negotiateCodec() (Codec, bool) {
+	def := ctx.Codec
+	if def == nil {
+		def = DefaultCodec
+	}
+	ctx.varyAccept()
+	return NegotiateCodec(ctx.ReqHeader("Accept"), def)
+}
+
+func (ctx *Context) varyAccept() {
+	h := ctx.Header()
+	if !slices.Contains(h.Values("Vary"), "Accept") {
+		h.Add("Vary", "Accept")
+	}
+}
+
+// Negotiated is a Codec that picks the response's codec from the request's Accept header, ex:
+//
+//	gserv.Get[gserv.Negotiated](g, "/users/:id", getUser, true)
+//	return gserv.NewNegotiatedResponse(user)
+//
+// Requests are decoded based on their Content-Type, see RegisterCodec.
+// If nothing matches the Accept header, a 406 is returned instead of the response.
+type Negotiated struct{}
+
+func (Negotiated) ContentType() string { return DefaultCodec.ContentType() }
+
+func (Negotiated) Decode(r io.Reader, out any) error { return DefaultCodec.Decode(r, out) }
+
+func (Negotiated) Encode(w io.Writer, v any) error {
+	if ctx, ok := w.(*Context); ok {
+		if c, ok := ctx.negotiateCodec(); ok {
+			return c.Encode(w, v)
+		}
+	}
+	return DefaultCodec.Encode(w, v)
+}
+
+func (Negotiated) codecFor(ctx *Context) (Codec, bool) {
+	return ctx.negotiateCodec()
+}
+
+// ctxCodec is implemented by codecs that depend on the request, ex: Negotiated.
+type ctxCodec interface {
+	codecFor(ctx *Context) (Codec, bool)
+}
+
+// resolveCodec returns c, or the codec it resolves to for ctx.
+func resolveCodec(ctx *Context, c Codec) (Codec, bool) {
+	if cc, ok := c.(ctxCodec); ok {
+		return cc.codecFor(ctx)
+	}
+	return c, true
+}
+
+type NegotiatedResponse = GenResponse[Negotiated]
+
+// NewNegotiatedResponse returns a new success response (code 200) with the specific data,
+// encoded with the codec that best matches the request's Accept header.
+func NewNegotiatedResponse(data any) *NegotiatedResponse {
+	return NewResponse[Negotiated](data)
+}
+
+func NewNegotiatedErrorResponse(code int, errs ...any) *NegotiatedResponse {
+	return NewErrorResponse[Negotiated](code, errs...)
+}
+
+var _ Codec = Negotiated{}
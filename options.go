@@ -1,7 +1,11 @@
 package gserv
 
 import (
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"net/netip"
 	"time"
 
 	"go.oneofone.dev/gserv/router"
@@ -10,11 +14,19 @@ import (
 // Options allows finer control over the gserv
 type Options struct {
 	Logger         *log.Logger
+	SLogger        *slog.Logger // if set, it's used instead of Logger, see Context.Logger
 	RouterOptions  *router.Options
 	ReadTimeout    time.Duration
 	WriteTimeout   time.Duration
 	MaxHeaderBytes int
 
+	// TrustedProxies are the proxies whose forwarding headers are used by Context.ClientIP, Scheme and Host.
+	TrustedProxies []netip.Prefix
+
+	// TrustedProxyHeader is the only header the client ip is read from when the request comes from one of TrustedProxies,
+	// one of ProxyHeaderForwarded, ProxyHeaderXForwardedFor or ProxyHeaderXRealIP, defaults to ProxyHeaderXForwardedFor.
+	TrustedProxyHeader string
+
 	CatchPanics              bool
 	EnableDefaultHTTPLogging bool // disables the spam on disconnects and tls, it can hide important messages sometimes
 }
@@ -53,6 +65,13 @@ func SetErrLogger(v *log.Logger) Option {
 	}
 }
 
+// SetSLogger sets the structured logger on the server, it takes priority over the error logger.
+func SetSLogger(v *slog.Logger) Option {
+	return func(opt *Options) {
+		opt.SLogger = v
+	}
+}
+
 // SetRouterOptions sets gserv/router.Options on the server.
 func SetRouterOptions(v *router.Options) Option {
 	return func(opt *Options) {
@@ -78,3 +97,70 @@ func SetOnReqDone(fn router.OnRequestDone) Option {
 		opt.RouterOptions.OnRequestDone = fn
 	}
 }
+
+// SetOnReqInfo sets the router's OnRequestInfo hook, the RequestInfo has the status and bytes written by the handlers.
+func SetOnReqInfo(fn router.OnRequestInfo) Option {
+	return func(opt *Options) {
+		if opt.RouterOptions == nil {
+			opt.RouterOptions = &router.Options{}
+		}
+		opt.RouterOptions.OnRequestInfo = fn
+	}
+}
+
+// SetAutoOptions toggles automatically responding to OPTIONS requests with the allowed methods for the path.
+func SetAutoOptions(enable bool) Option {
+	return func(opt *Options) {
+		if opt.RouterOptions == nil {
+			opt.RouterOptions = &router.Options{}
+		}
+		opt.RouterOptions.AutoOptions = enable
+	}
+}
+
+// SetTrustedProxies sets the proxies whose forwarding headers are trusted, each entry is a CIDR or a single ip, ex:
+//
+//	SetTrustedProxies("10.0.0.0/8", "127.0.0.1", "::1")
+//
+// It panics if an entry is invalid.
+func SetTrustedProxies(cidrs ...string) Option {
+	pfxs := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			ip, err2 := netip.ParseAddr(c)
+			if err2 != nil {
+				panic(fmt.Sprintf("gserv: invalid trusted proxy %q: %v", c, err))
+			}
+			p = netip.PrefixFrom(ip, ip.BitLen())
+		}
+		pfxs = append(pfxs, p.Masked())
+	}
+
+	return func(opt *Options) {
+		opt.TrustedProxies = pfxs
+	}
+}
+
+// The headers a trusted proxy can set the client ip in, see SetTrustedProxyHeader.
+const (
+	ProxyHeaderForwarded     = "Forwarded"       // RFC 7239, the proto and host params are used by Context.Scheme and Host
+	ProxyHeaderXForwardedFor = "X-Forwarded-For" // with X-Forwarded-Proto and X-Forwarded-Host
+	ProxyHeaderXRealIP       = "X-Real-Ip"       // with X-Forwarded-Proto and X-Forwarded-Host
+)
+
+// SetTrustedProxyHeader sets the header trusted proxies set the client ip in, the others are ignored,
+// it must match what the proxy actually sets, or clients can spoof their ip.
+//
+// It panics if h isn't one of ProxyHeaderForwarded, ProxyHeaderXForwardedFor or ProxyHeaderXRealIP.
+func SetTrustedProxyHeader(h string) Option {
+	switch h = http.CanonicalHeaderKey(h); h {
+	case ProxyHeaderForwarded, ProxyHeaderXForwardedFor, ProxyHeaderXRealIP:
+	default:
+		panic(fmt.Sprintf("gserv: invalid trusted proxy header %q", h))
+	}
+
+	return func(opt *Options) {
+		opt.TrustedProxyHeader = h
+	}
+}
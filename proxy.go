@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"strings"
+
+	"go.oneofone.dev/gserv/trace"
 )
 
 var hopHeaders = []string{
@@ -47,7 +49,9 @@ func ProxyHandler(host string, pathFn func(req *http.Request, path string) strin
 		for _, hh := range hopHeaders {
 			h.Del(hh)
 		}
-		h.Set("X-Forwarded-For", req.RemoteAddr)
+		// httputil.ReverseProxy appends the peer's ip to X-Forwarded-For, see Context.ClientIP
+		trace.Inject(req.Context(), h)
+		injectRequestID(req.Context(), h)
 	}
 
 	rp.ModifyResponse = func(r *http.Response) error {
@@ -0,0 +1,208 @@
+// Package ratelimit implements a rate limiting middleware with token bucket and sliding window algorithms, ex:
+//
+//	rl := ratelimit.New(ratelimit.PerMinute(60), nil)
+//	api := srv.SubGroup("api", "/api", rl.Middleware())
+//	ratelimit.Override(api.POST("/login", login), ratelimit.PerMinute(5))
+package ratelimit
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"go.oneofone.dev/gserv"
+	"go.oneofone.dev/gserv/apiutils"
+)
+
+type Algorithm uint8
+
+const (
+	TokenBucket Algorithm = iota
+	SlidingWindow
+)
+
+// Limit allows Rate requests per Period, a zero Rate disables limiting, ex: for routes that override their group's limit.
+type Limit struct {
+	Algorithm Algorithm
+	Rate      int
+	Period    time.Duration
+	Burst     int // the token bucket's capacity, defaults to Rate
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// PerSecond returns a token bucket Limit of n requests per second.
+func PerSecond(n int) Limit { return Limit{Rate: n, Period: time.Second} }
+
+// PerMinute returns a token bucket Limit of n requests per minute.
+func PerMinute(n int) Limit { return Limit{Rate: n, Period: time.Minute} }
+
+// PerHour returns a token bucket Limit of n requests per hour.
+func PerHour(n int) Limit { return Limit{Rate: n, Period: time.Hour} }
+
+// KeyFunc returns the key requests are counted by, ex: ByIP.
+type KeyFunc func(ctx *gserv.Context) string
+
+// ByIP counts requests by Context.ClientIP, see gserv.SetTrustedProxies.
+func ByIP(ctx *gserv.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// BySubject counts requests by the subject of the JWT set by apiutils.Auth, or by ip if there's no token or it has no subject.
+// The subject is read from SubjectClaims, jwt.MapClaims' "sub", or the Subject field of a claims struct,
+// ex: jwt.RegisteredClaims or a custom type embedding it.
+func BySubject(ctx *gserv.Context) string {
+	var claims jwt.Claims
+	switch tok := ctx.Get(apiutils.TokenContextKey).(type) {
+	case *jwt.Token:
+		claims = tok.Claims
+	case apiutils.Token:
+		if tok.Token != nil {
+			claims = tok.Claims
+		}
+	}
+
+	var sub string
+	switch c := claims.(type) {
+	case nil:
+	case SubjectClaims:
+		if s, err := c.GetSubject(); err == nil {
+			sub = s
+		}
+	case jwt.MapClaims:
+		sub, _ = c["sub"].(string)
+	default:
+		sub = subjectField(c)
+	}
+
+	if sub == "" {
+		return ByIP(ctx)
+	}
+	return "sub:" + sub
+}
+
+// SubjectClaims is implemented by custom claims to be used with BySubject, it matches jwt/v5's Claims.GetSubject.
+type SubjectClaims interface {
+	GetSubject() (string, error)
+}
+
+// subjectField returns the Subject string field of a claims struct or pointer to one, if any.
+func subjectField(claims jwt.Claims) string {
+	v := reflect.ValueOf(claims)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	sf, ok := v.Type().FieldByName("Subject")
+	if !ok || sf.Type.Kind() != reflect.String {
+		return ""
+	}
+	f, err := v.FieldByIndexErr(sf.Index)
+	if err != nil { // nil embedded pointer
+		return ""
+	}
+	return f.String()
+}
+
+// Options are the Limiter's options, all the fields are optional.
+type Options struct {
+	Key   KeyFunc // defaults to ByIP
+	Store Store   // defaults to NewMemoryStore()
+
+	// OnError is called if the store returns an error, the request is allowed unless FailClosed is set.
+	OnError    func(ctx *gserv.Context, err error)
+	FailClosed bool
+}
+
+// Limiter limits requests to the routes it's used on.
+type Limiter struct {
+	limit  Limit
+	opts   Options
+	prefix string
+}
+
+var nextID atomic.Uint64
+
+// New returns a Limiter that applies l to the routes it's used on, opts can be nil.
+func New(l Limit, opts *Options) *Limiter {
+	rl := &Limiter{limit: l, prefix: strconv.FormatUint(nextID.Add(1), 10) + "|"}
+	if opts != nil {
+		rl.opts = *opts
+	}
+	if rl.opts.Key == nil {
+		rl.opts.Key = ByIP
+	}
+	if rl.opts.Store == nil {
+		rl.opts.Store = NewMemoryStore()
+	}
+	return rl
+}
+
+const metaKey = "ratelimit"
+
+// Override sets the limit used for route instead of its group's limiter's, it returns the route so it can be chained.
+// Overridden routes are counted separately from the rest of the group.
+func Override(route gserv.Route, l Limit) gserv.Route {
+	return route.Meta(metaKey, l)
+}
+
+// Middleware returns the rate limiting middleware, it sets the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers, and returns a 429 with Retry-After once the limit is reached.
+func (rl *Limiter) Middleware() gserv.Handler {
+	return func(ctx *gserv.Context) gserv.Response {
+		l, key := rl.limit, rl.prefix
+		if rn := ctx.Route(); rn != nil {
+			if v, ok := rn.MetaValue(metaKey); ok {
+				l = v.(Limit)
+				key += ctx.Req.Method + " " + rn.Path() + "|"
+			}
+		}
+
+		if l.Rate <= 0 || l.Period <= 0 {
+			return nil
+		}
+		key += rl.opts.Key(ctx)
+
+		res, err := rl.opts.Store.Allow(ctx.Req.Context(), key, l, time.Now())
+		if err != nil {
+			if rl.opts.OnError != nil {
+				rl.opts.OnError(ctx, err)
+			}
+			if rl.opts.FailClosed {
+				return gserv.NewJSONErrorResponse(http.StatusServiceUnavailable)
+			}
+			return nil
+		}
+
+		h := ctx.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+		h.Set("RateLimit-Policy", strconv.Itoa(res.Limit)+";w="+strconv.Itoa(seconds(l.Period)))
+
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+			return gserv.NewJSONErrorResponse(http.StatusTooManyRequests)
+		}
+		return nil
+	}
+}
+
+// seconds rounds d up to the nearest second.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,171 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"go.oneofone.dev/gserv"
+	"go.oneofone.dev/gserv/apiutils"
+	"go.oneofone.dev/gserv/ratelimit"
+)
+
+func TestTokenBucket(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+	l := ratelimit.Limit{Rate: 2, Period: time.Second, Burst: 3}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if r, _ := s.Allow(context.Background(), "k", l, now); !r.Allowed || r.Remaining != 2-i {
+			t.Fatalf("%d: unexpected result: %+v", i, r)
+		}
+	}
+
+	r, _ := s.Allow(context.Background(), "k", l, now)
+	if r.Allowed || r.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	if r, _ = s.Allow(context.Background(), "k", l, now.Add(500*time.Millisecond)); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	if r, _ = s.Allow(context.Background(), "other", l, now); !r.Allowed || r.Remaining != 2 {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+	l := ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Rate: 4, Period: time.Minute}
+	now := time.Now()
+
+	for i := 0; i < 4; i++ {
+		if r, _ := s.Allow(context.Background(), "k", l, now); !r.Allowed || r.Remaining != 3-i {
+			t.Fatalf("%d: unexpected result: %+v", i, r)
+		}
+	}
+
+	if r, _ := s.Allow(context.Background(), "k", l, now.Add(30*time.Second)); r.Allowed || r.RetryAfter != 30*time.Second {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	// 4 requests in the previous window, weighted by 0.5
+	now = now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		if r, _ := s.Allow(context.Background(), "k", l, now); !r.Allowed {
+			t.Fatalf("%d: unexpected result: %+v", i, r)
+		}
+	}
+	if r, _ := s.Allow(context.Background(), "k", l, now); r.Allowed || r.RetryAfter != 15*time.Second {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	rl := ratelimit.New(ratelimit.PerMinute(2), nil)
+
+	srv := gserv.New(gserv.SetErrLogger(nil))
+	api := srv.SubGroup("api", "/api", rl.Middleware())
+	api.GET("/a", func(ctx *gserv.Context) gserv.Response { return gserv.NewJSONResponse("a") })
+	ratelimit.Override(api.GET("/b", func(ctx *gserv.Context) gserv.Response { return gserv.NewJSONResponse("b") }), ratelimit.PerMinute(1))
+	ratelimit.Override(api.GET("/c", func(ctx *gserv.Context) gserv.Response { return gserv.NewJSONResponse("c") }), ratelimit.Limit{})
+
+	get := func(path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, exp := range []int{200, 200, 429} {
+		rr := get("/api/a", "1.1.1.1")
+		if rr.Code != exp {
+			t.Fatalf("%d: expected %d, got %d", i, exp, rr.Code)
+		}
+		if h := rr.Header(); h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Policy") != "2;w=60" {
+			t.Fatalf("%d: unexpected headers: %v", i, h)
+		}
+		if exp == 429 && rr.Header().Get("Retry-After") != "30" {
+			t.Fatalf("unexpected Retry-After: %v", rr.Header())
+		}
+	}
+
+	if rr := get("/api/a", "2.2.2.2"); rr.Code != 200 {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	for i, exp := range []int{200, 429} {
+		if rr := get("/api/b", "1.1.1.1"); rr.Code != exp || rr.Header().Get("RateLimit-Limit") != "1" {
+			t.Fatalf("%d: expected %d, got %d (%v)", i, exp, rr.Code, rr.Header())
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		if rr := get("/api/c", "1.1.1.1"); rr.Code != 200 || rr.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("%d: unexpected response: %d %v", i, rr.Code, rr.Header())
+		}
+	}
+}
+
+type customClaims struct {
+	jwt.RegisteredClaims
+	Role string
+	err  error
+}
+
+func (c *customClaims) GetSubject() (string, error) { return c.Subject, c.err }
+
+type embeddedClaims struct {
+	*jwt.StandardClaims
+	Role string
+}
+
+type unknownClaims struct{ Role string }
+
+func (unknownClaims) Valid() error { return nil }
+
+func TestBySubject(t *testing.T) {
+	key := func(claims jwt.Claims) (key string) {
+		srv := gserv.New(gserv.SetErrLogger(nil), gserv.SetCatchPanics(false))
+		srv.GET("/", func(ctx *gserv.Context) gserv.Response {
+			if claims != nil {
+				ctx.Set(apiutils.TokenContextKey, apiutils.Token{Token: &jwt.Token{Claims: claims}})
+			}
+			key = ratelimit.BySubject(ctx)
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+		return
+	}
+
+	for _, tc := range []struct {
+		claims jwt.Claims
+		exp    string
+	}{
+		{nil, "ip:1.1.1.1"},
+		{jwt.MapClaims{"sub": "a"}, "sub:a"},
+		{&jwt.RegisteredClaims{Subject: "b"}, "sub:b"},
+		{jwt.RegisteredClaims{Subject: "b"}, "sub:b"},
+		{&jwt.StandardClaims{Subject: "s"}, "sub:s"},
+		{jwt.StandardClaims{Subject: "s"}, "sub:s"},
+		{&customClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "c"}}, "sub:c"},
+		{&customClaims{}, "ip:1.1.1.1"},
+		{&customClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "c"}, err: errors.New("bad sub")}, "ip:1.1.1.1"},
+		{embeddedClaims{StandardClaims: &jwt.StandardClaims{Subject: "e"}}, "sub:e"},
+		{embeddedClaims{}, "ip:1.1.1.1"},
+		{unknownClaims{Role: "admin"}, "ip:1.1.1.1"},
+		{(*jwt.RegisteredClaims)(nil), "ip:1.1.1.1"},
+	} {
+		if k := key(tc.claims); k != tc.exp {
+			t.Fatalf("%T: expected %q, got %q", tc.claims, tc.exp, k)
+		}
+	}
+}
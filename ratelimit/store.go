@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of a Store.Allow call.
+type Result struct {
+	Allowed    bool
+	Limit      int           // the max number of requests per window, or the bucket's capacity
+	Remaining  int           // the number of requests left in the current window or bucket
+	Reset      time.Duration // time until the window resets, or the bucket is full
+	RetryAfter time.Duration // time until the next request is allowed, 0 if Allowed
+}
+
+// Store holds the rate limiting state, MemoryStore is the in-memory implementation.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Allow records a request for key if it's allowed by l.
+	Allow(ctx context.Context, key string, l Limit, now time.Time) (Result, error)
+}
+
+const numShards = 64
+
+// MemoryStore is a sharded in-memory Store, expired keys are removed lazily.
+type MemoryStore struct {
+	seed   maphash.Seed
+	shards [numShards]memShard
+}
+
+type memShard struct {
+	mux  sync.Mutex
+	m    map[string]*memEntry
+	hits uint
+}
+
+type memEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	// sliding window
+	start      time.Time
+	prev, curr int
+
+	expires time.Time
+}
+
+// NewMemoryStore returns a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{seed: maphash.MakeSeed()}
+	for i := range s.shards {
+		s.shards[i].m = map[string]*memEntry{}
+	}
+	return s
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, l Limit, now time.Time) (Result, error) {
+	sh := &s.shards[maphash.String(s.seed, key)%numShards]
+	sh.mux.Lock()
+	defer sh.mux.Unlock()
+
+	if sh.hits++; sh.hits%1024 == 0 {
+		sh.evict(now)
+	}
+
+	e := sh.m[key]
+	if e == nil || now.After(e.expires) {
+		e = &memEntry{tokens: float64(l.burst()), last: now, start: now}
+		sh.m[key] = e
+	}
+
+	if l.Algorithm == SlidingWindow {
+		return e.slidingWindow(l, now), nil
+	}
+	return e.tokenBucket(l, now), nil
+}
+
+func (sh *memShard) evict(now time.Time) {
+	for k, e := range sh.m {
+		if now.After(e.expires) {
+			delete(sh.m, k)
+		}
+	}
+}
+
+func (e *memEntry) tokenBucket(l Limit, now time.Time) (r Result) {
+	var (
+		burst = float64(l.burst())
+		rate  = float64(l.Rate) / float64(l.Period) // tokens per ns
+	)
+
+	e.tokens = math.Min(burst, e.tokens+float64(now.Sub(e.last))*rate)
+	e.last = now
+
+	if r.Allowed = e.tokens >= 1; r.Allowed {
+		e.tokens--
+	} else {
+		r.RetryAfter = time.Duration(math.Ceil((1 - e.tokens) / rate))
+	}
+
+	r.Limit, r.Remaining = int(burst), int(e.tokens)
+	r.Reset = time.Duration(math.Ceil((burst - e.tokens) / rate))
+	e.expires = now.Add(r.Reset)
+	return
+}
+
+// slidingWindow approximates a sliding log by weighting the previous window's count
+// by how much of it overlaps the sliding window.
+func (e *memEntry) slidingWindow(l Limit, now time.Time) (r Result) {
+	if elapsed := now.Sub(e.start); elapsed >= l.Period {
+		n := elapsed / l.Period
+		if n == 1 {
+			e.prev = e.curr
+		} else {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.start = e.start.Add(n * l.Period)
+	}
+
+	elapsed := now.Sub(e.start)
+	weight := 1 - float64(elapsed)/float64(l.Period)
+	count := float64(e.prev)*weight + float64(e.curr)
+
+	if r.Allowed = count+1 <= float64(l.Rate); r.Allowed {
+		e.curr++
+		count++
+	} else if e.curr >= l.Rate || e.prev == 0 {
+		r.RetryAfter = l.Period - elapsed
+	} else {
+		// the time until enough of the previous window slides out
+		need := (count + 1 - float64(l.Rate)) / float64(e.prev)
+		r.RetryAfter = time.Duration(math.Ceil(need * float64(l.Period)))
+	}
+
+	r.Limit, r.Remaining = l.Rate, max(0, l.Rate-int(math.Ceil(count)))
+	r.Reset = l.Period - elapsed
+	e.expires = e.start.Add(2 * l.Period)
+	return
+}
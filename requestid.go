@@ -0,0 +1,91 @@
+package gserv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID returns a middleware that sets the request's id, which is taken from the X-Request-Id header if valid,
+// or generated with NewRequestID.
+// The id is returned in the X-Request-Id response header, in error responses and structured logs,
+// and is forwarded by ProxyHandler and JSONRequestCtx.
+// It should be added before LogRequests, otherwise LogRequests logs its own counter instead.
+func RequestID() Handler {
+	return func(ctx *Context) Response {
+		id := ctx.Req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+
+		ctx.reqID, ctx.logger = id, nil
+		ctx.Req = ctx.Req.WithContext(ContextWithRequestID(ctx.Req.Context(), id))
+		ctx.Header().Set(RequestIDHeader, id)
+		return nil
+	}
+}
+
+// NewRequestID returns a new UUIDv7, which sorts by creation time.
+func NewRequestID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(u[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(u[2:], uint32(ms))
+	u[6] = u[6]&0x0f | 0x70 // version 7
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// validRequestID accepts up to 128 printable ascii characters, so client ids can't be used to inject into logs or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the request's id set by the RequestID middleware, if any.
+func (ctx *Context) RequestID() string {
+	return ctx.reqID
+}
+
+type reqIDCtxKey struct{}
+
+// ContextWithRequestID returns a copy of ctx holding the request id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, reqIDCtxKey{}, id)
+}
+
+// RequestIDFromContext returns the request id in ctx, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(reqIDCtxKey{}).(string)
+	return id
+}
+
+func injectRequestID(ctx context.Context, h http.Header) {
+	if id := RequestIDFromContext(ctx); id != "" {
+		h.Set(RequestIDHeader, id)
+	}
+}
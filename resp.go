@@ -2,6 +2,7 @@ package gserv
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,8 @@ import (
 	"net/http"
 	"path/filepath"
 
+	"go.oneofone.dev/gserv/internal"
+	"go.oneofone.dev/gserv/trace"
 	"go.oneofone.dev/oerrs"
 	"go.oneofone.dev/otk"
 )
@@ -19,6 +22,8 @@ var (
 	RespNotFound         Response = NewJSONErrorResponse(http.StatusNotFound).Cached()
 	RespForbidden        Response = NewJSONErrorResponse(http.StatusForbidden).Cached()
 	RespBadRequest       Response = NewJSONErrorResponse(http.StatusBadRequest).Cached()
+	RespNotAcceptable    Response = NewJSONErrorResponse(http.StatusNotAcceptable).Cached()
+	RespTimeout          Response = NewJSONErrorResponse(http.StatusServiceUnavailable, "request timed out").Cached()
 	RespOK               Response = NewJSONResponse("OK").Cached()
 	RespEmpty            Response = CachedResponse(http.StatusNoContent, "", nil)
 	RespPlainOK          Response = CachedResponse(http.StatusOK, "", nil)
@@ -135,6 +140,38 @@ func JSONRequest(method, url string, reqData, respData any) (err error) {
 	})
 }
 
+// JSONRequestCtx is like JSONRequest, but uses ctx for the request and propagates its trace context and request id,
+// see Trace and RequestID.
+func JSONRequestCtx(ctx context.Context, method, url string, reqData, respData any) error {
+	var body io.Reader
+	if reqData != nil {
+		j, err := internal.Marshal(reqData)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(j)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+
+	if reqData != nil {
+		req.Header.Set("Content-Type", MimeJSON)
+	}
+	trace.Inject(ctx, req.Header)
+	injectRequestID(ctx, req.Header)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = ReadJSONResponse(resp.Body, respData)
+	return err
+}
+
 // Redirect returns a redirect Response.
 // if perm is false it uses http.StatusFound (302), otherwise http.StatusMovedPermanently (302)
 func Redirect(url string, perm bool) Response {
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// constraint validates a param's value during matching, ex: `:id<int>` or `:slug<[a-z-]+>`.
+type constraint struct {
+	raw    string
+	typ    string // swagger type
+	format string // swagger format
+	fn     func(v string) bool
+}
+
+func (c *constraint) allows(v string) bool {
+	return c == nil || c.fn(v)
+}
+
+func (c *constraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.raw
+}
+
+var builtinConstraints = map[string]*constraint{
+	"int":   {raw: "int", typ: "integer", format: "int64", fn: isInt},
+	"uint":  {raw: "uint", typ: "integer", format: "int64", fn: isUint},
+	"float": {raw: "float", typ: "number", format: "double", fn: isFloat},
+	"bool":  {raw: "bool", typ: "boolean", fn: isBool},
+	"alpha": {raw: "alpha", typ: "string", fn: isAlpha},
+	"alnum": {raw: "alnum", typ: "string", fn: isAlnum},
+	"uuid":  {raw: "uuid", typ: "string", format: "uuid", fn: isUUID},
+}
+
+// compileConstraint returns one of the builtin constraints, or treats s as a regexp that has to match the whole value.
+func compileConstraint(s string) (*constraint, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if c := builtinConstraints[s]; c != nil {
+		return c, nil
+	}
+
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint <%s>: %w", s, err)
+	}
+
+	return &constraint{raw: s, typ: "string", fn: re.MatchString}, nil
+}
+
+func isInt(v string) bool {
+	if v != "" && (v[0] == '-' || v[0] == '+') {
+		v = v[1:]
+	}
+	return isUint(v)
+}
+
+func isUint(v string) bool {
+	if v == "" {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isFloat(v string) bool {
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
+
+func isBool(v string) bool {
+	_, err := strconv.ParseBool(v)
+	return err == nil
+}
+
+func isAlpha(v string) bool {
+	if v == "" {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if c := v[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(v string) bool {
+	if v == "" {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; (c < '0' || c > '9') && (c|0x20 < 'a' || c|0x20 > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(v string) bool {
+	_, ok := parseUUID(v)
+	return ok
+}
+
+// parseUUID parses the canonical 8-4-4-4-12 hex form.
+func parseUUID(v string) (u UUID, ok bool) {
+	if len(v) != 36 || v[8] != '-' || v[13] != '-' || v[18] != '-' || v[23] != '-' {
+		return
+	}
+
+	for i, j := 0, 0; i < len(v); i += 2 {
+		if v[i] == '-' {
+			i++
+		}
+		hi, ok1 := fromHex(v[i])
+		lo, ok2 := fromHex(v[i+1])
+		if !ok1 || !ok2 {
+			return
+		}
+		u[j] = hi<<4 | lo
+		j++
+	}
+
+	return u, true
+}
+
+func fromHex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
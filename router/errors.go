@@ -0,0 +1,61 @@
+package router
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors returned by TryAddRoute, they're always wrapped in a *RouteError.
+var (
+	// ErrInvalidMethod is returned if the method isn't a valid http token.
+	ErrInvalidMethod = errors.New("invalid method")
+	// ErrTooManyStars is returned if there are multiple *params in the path.
+	ErrTooManyStars = errors.New("too many stars")
+	// ErrStarNotLast is returned if *param is not the last part of the path.
+	ErrStarNotLast = errors.New("star param must be the last part of the path")
+	// ErrInvalidConstraint is returned if a param constraint isn't a builtin or a valid regexp.
+	ErrInvalidConstraint = errors.New("invalid param constraint")
+	// ErrDuplicateRoute is returned if the method and path are already registered.
+	ErrDuplicateRoute = errors.New("duplicate route")
+	// ErrAmbiguousParams is returned if a route only differs from an existing one by its param names,
+	// or if it has a different param name than an existing route at the same position, ex: /users/:id and /users/:uid/posts.
+	ErrAmbiguousParams = errors.New("ambiguous param names")
+	// ErrShadowedRoute is returned if a route only differs from an existing one by its star name,
+	// meaning the earlier catch-all will always match first.
+	ErrShadowedRoute = errors.New("route is shadowed by an earlier catch-all")
+)
+
+// Errors returned by URLFor.
+var (
+	// ErrUnknownRoute is returned if there's no route with the given name.
+	ErrUnknownRoute = errors.New("unknown route")
+	// ErrMissingParam is returned if a route param wasn't passed.
+	ErrMissingParam = errors.New("missing param")
+	// ErrInvalidParam is returned if a param doesn't satisfy the route's constraint.
+	ErrInvalidParam = errors.New("invalid param")
+)
+
+// RouteError is returned when a route can't be added to the router.
+type RouteError struct {
+	Err      error  // one of the Err* errors
+	Method   string // the method of the invalid route
+	Path     string // the path of the invalid route
+	Conflict string // the path of the existing route it conflicts with, if any
+	Reason   string // extra details, if any
+}
+
+func (e *RouteError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("router: ")
+	sb.WriteString(e.Err.Error())
+	sb.WriteString(": " + e.Method + " " + e.Path)
+	if e.Conflict != "" {
+		sb.WriteString(" (conflicts with " + e.Conflict + ")")
+	}
+	if e.Reason != "" {
+		sb.WriteString(": " + e.Reason)
+	}
+	return sb.String()
+}
+
+func (e *RouteError) Unwrap() error { return e.Err }
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// hostRouter is a sub-router that only serves requests with a matching Host header.
+type hostRouter struct {
+	pattern string
+	labels  []string // `:name` captures a label, `*` matches any label
+	wild    int      // number of `:name` and `*` labels
+	r       *Router
+}
+
+// Host returns the sub-router serving requests for the host pattern, creating it if needed, ex:
+//
+//	r.Host("api.example.com")  // exact match
+//	r.Host("*.example.com")    // matches any single label
+//	r.Host(":sub.example.com") // same, but the label is available as the `sub` param
+//
+// Hosts are matched case-insensitively and without the port, exact hosts take priority over patterns,
+// and patterns with fewer wildcards over the rest, then the order they were added in.
+// The first matching host serves the request, even if it doesn't have a route for it.
+// Requests that don't match any host are served by r's own routes.
+// It panics if the pattern is invalid.
+func (r *Router) Host(pattern string) *Router {
+	r = r.top()
+	pattern = normalizeHost(pattern)
+	h := &hostRouter{pattern: pattern, labels: strings.Split(pattern, ".")}
+	nparams := 0
+	for _, l := range h.labels {
+		switch {
+		case l == "", l == ":", strings.IndexByte(l[1:], ':') != -1, l != "*" && strings.IndexByte(l, '*') != -1:
+			panic(fmt.Sprintf("router: invalid host pattern %q", pattern))
+		case l[0] == ':':
+			nparams++
+			fallthrough
+		case l == "*":
+			h.wild++
+		}
+	}
+
+	r.update(func(t *table) error {
+		for _, oh := range t.hosts {
+			if oh.pattern == pattern {
+				h = oh
+				return errHostExists
+			}
+		}
+
+		h.r = newRouter(&r.opts, r, nparams)
+		t.hosts = append(slices.Clone(t.hosts), h)
+		sort.SliceStable(t.hosts, func(i, j int) bool { return t.hosts[i].wild < t.hosts[j].wild })
+		return nil
+	})
+	return h.r
+}
+
+var errHostExists = errors.New("host exists")
+
+// Hosts returns the registered host patterns in the order they're matched.
+func (r *Router) Hosts() []string {
+	hosts := r.table().hosts
+	out := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		out = append(out, h.pattern)
+	}
+	return out
+}
+
+// matchHost returns the router for host and the captured host params, if any,
+// or r itself if no host matches.
+func (r *Router) matchHost(host string) (*Router, *paramsWrapper) {
+	host = normalizeHost(stripPort(host))
+	for _, h := range r.table().hosts {
+		if h.wild == 0 {
+			if h.pattern == host {
+				return h.r, nil
+			}
+			continue
+		}
+
+		var ps *paramsWrapper
+		if h.r.hostParams > 0 {
+			ps = h.r.getParams()
+		}
+		if h.match(host, ps) {
+			if len(ps.Params()) == 0 {
+				h.r.putParams(ps)
+				ps = nil
+			}
+			return h.r, ps
+		}
+		h.r.putParams(ps)
+	}
+	return r, nil
+}
+
+func (h *hostRouter) match(host string, ps *paramsWrapper) bool {
+	for i, l := range h.labels {
+		v := host
+		if j := strings.IndexByte(host, '.'); j != -1 {
+			v, host = host[:j], host[j+1:]
+		} else {
+			host = ""
+		}
+
+		switch {
+		case v == "", (host == "") != (i == len(h.labels)-1):
+		case l[0] == ':':
+			ps.p = append(ps.p, Param{l[1:], v})
+			continue
+		case l == "*", l == v:
+			continue
+		}
+
+		if ps != nil {
+			ps.p = ps.p[:0]
+		}
+		return false
+	}
+	return true
+}
+
+// top returns the router's parent if it's a host router, or the router itself.
+func (r *Router) top() *Router {
+	if r.root != nil {
+		return r.root
+	}
+	return r
+}
+
+func normalizeHost(h string) string {
+	return strings.ToLower(strings.TrimSuffix(h, "."))
+}
+
+func stripPort(h string) string {
+	if i := strings.LastIndexByte(h, ':'); i != -1 && strings.IndexByte(h[i:], ']') == -1 {
+		return h[:i]
+	}
+	return h
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"maps"
+	"slices"
+)
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method string         `json:"method"`
+	Path   string         `json:"path"`
+	Group  string         `json:"group,omitempty"`
+	Name   string         `json:"name,omitempty"`
+	Meta   map[string]any `json:"meta,omitempty"`
+}
+
+// Meta sets a metadata value on the route, ex: route.Meta("auth", "admin").Meta("public", true).
+// It's safe to call while serving requests.
+func (n *Route) Meta(key string, value any) *Route {
+	for {
+		old := n.meta.Load()
+		var m map[string]any
+		if old != nil {
+			m = maps.Clone(*old)
+		} else {
+			m = map[string]any{}
+		}
+		m[key] = value
+		if n.meta.CompareAndSwap(old, &m) {
+			return n
+		}
+	}
+}
+
+// MetaValue returns the route's metadata value for key.
+func (n *Route) MetaValue(key string) (v any, ok bool) {
+	if m := n.meta.Load(); m != nil {
+		v, ok = (*m)[key]
+	}
+	return
+}
+
+// Info returns the route's info, Meta is a copy of the route's metadata.
+func (n *Route) Info() RouteInfo {
+	ri := RouteInfo{Method: n.m, Path: n.fp, Group: n.g, Name: n.routeName()}
+	if m := n.meta.Load(); m != nil {
+		ri.Meta = maps.Clone(*m)
+	}
+	return ri
+}
+
+// RoutesInfo returns the info of all the registered routes, in the order they were added.
+func (r *Router) RoutesInfo() []RouteInfo {
+	rs := r.table().routes
+	out := make([]RouteInfo, 0, len(rs))
+	for _, rn := range rs {
+		out = append(out, rn.Info())
+	}
+	return out
+}
+
+// Routes returns all the registered routes, in the order they were added.
+func (r *Router) Routes() []*Route {
+	return slices.Clone(r.table().routes)
+}
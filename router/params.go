@@ -1,5 +1,11 @@
 package router
 
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
 // Param is a key/value pair
 type Param struct {
 	Name  string
@@ -31,6 +37,21 @@ func (p Params) GetExt(name string) (val, ext string) {
 	return
 }
 
+// GetInt returns the named param parsed as an int, useful with `:id<int>` params.
+func (p Params) GetInt(name string) (int, error) {
+	return strconv.Atoi(p.Get(name))
+}
+
+// GetUUID returns the named param parsed as a UUID, useful with `:id<uuid>` params.
+func (p Params) GetUUID(name string) (UUID, error) {
+	v := p.Get(name)
+	u, ok := parseUUID(v)
+	if !ok {
+		return u, fmt.Errorf("invalid uuid: %q", v)
+	}
+	return u, nil
+}
+
 // Copy returns a copy of p, required if you want to store it somewhere or use it outside of your handler.
 func (p Params) Copy() Params {
 	op := make(Params, len(p))
@@ -49,3 +70,21 @@ func (pw *paramsWrapper) Params() (p Params) {
 	}
 	return
 }
+
+// UUID is a raw RFC 4122 UUID.
+type UUID [16]byte
+
+// String returns the canonical 8-4-4-4-12 form of the UUID.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+var origPathCtxKey = struct{ name string }{"origPath"}
+
+// OriginalPath returns the request's path before the router cleaned it, or req.URL.Path if it wasn't modified.
+func OriginalPath(req *http.Request) string {
+	if p, ok := req.Context().Value(origPathCtxKey).(string); ok {
+		return p
+	}
+	return req.URL.Path
+}
+
+func withOriginalPath(req *http.Request, p string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), origPathCtxKey, p))
+}
+
+// redirectPath returns the escaped path to redirect to according to Options.RedirectTrailingSlash
+// and Options.RedirectFixedPath, or an empty string if there isn't one.
+func (r *Router) redirectPath(method string, req *http.Request) string {
+	path := req.URL.Path
+
+	if r.opts.RedirectTrailingSlash {
+		if alt := toggleSlash(path); alt != "" && r.routeFor(method, alt) != nil {
+			return toggleSlash(req.URL.EscapedPath())
+		}
+	}
+
+	if r.opts.RedirectFixedPath {
+		if u := r.fixedPath(method, path); u != "" {
+			return u
+		}
+		if alt := toggleSlash(path); alt != "" && r.opts.RedirectTrailingSlash {
+			return r.fixedPath(method, alt)
+		}
+	}
+
+	return ""
+}
+
+// routeFor returns the enabled route for method and path.
+func (r *Router) routeFor(method, path string) (rn *Route) {
+	var ps *paramsWrapper
+	if n := r.table().getTree(method, false); n != nil {
+		ps = r.getParams()
+		if rn = n.lookup(path, ps, false); rn != nil && rn.disabled.Load() {
+			rn = nil
+		}
+		r.putParams(ps)
+	}
+	return
+}
+
+// fixedPath returns the escaped path of the route matching path case-insensitively.
+func (r *Router) fixedPath(method, path string) string {
+	n := r.table().getTree(method, false)
+	if n == nil {
+		return ""
+	}
+
+	ps := r.getParams()
+	defer r.putParams(ps)
+
+	rn := n.lookup(path, ps, true)
+	if rn == nil || rn.disabled.Load() {
+		return ""
+	}
+
+	kv := make([]string, 0, len(ps.p)*2)
+	for _, p := range ps.p {
+		kv = append(kv, p.Name, p.Value)
+	}
+
+	u, err := rn.URL(kv...)
+	if err != nil {
+		return ""
+	}
+	return u
+}
+
+func toggleSlash(p string) string {
+	switch {
+	case p == "/":
+		return ""
+	case strings.HasSuffix(p, "/"):
+		return p[:len(p)-1]
+	default:
+		return p + "/"
+	}
+}
+
+func redirect(w http.ResponseWriter, req *http.Request, u string) {
+	code := http.StatusPermanentRedirect
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+
+	if q := req.URL.RawQuery; q != "" {
+		u += "?" + q
+	}
+
+	http.Redirect(w, req, u, code)
+}
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type OnRequestInfo = func(ctx context.Context, ri *RequestInfo)
+
+// RequestInfo is passed to Options.OnRequestInfo after a matched route is served.
+// Each request gets its own RequestInfo, so it can be retained.
+type RequestInfo struct {
+	Group  string
+	Method string
+	Route  string // the route's pattern, ex: /users/:id
+	Path   string // the request's path
+
+	// Status and BytesWritten are set by the handler, ex: gserv sets them from its Context,
+	// plain handlers can set them with RequestInfoFromRequest.
+	Status       int
+	BytesWritten int64
+	BytesRead    int64 // the amount of bytes read from the request's body
+	Duration     time.Duration
+	Panicked     bool // the handler panicked, only reported if the panic was recovered
+
+	body *countingBody
+}
+
+// countingBody counts the bytes read from the body, it has its own counter since a handler's goroutine
+// can keep reading the body after the request is done, ex: Timeout, BytesRead is set from it once the route is served.
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return
+}
+
+var reqInfoCtxKey = struct{ name string }{"reqInfo"}
+
+// RequestInfoFromRequest returns the request's *RequestInfo if Options.OnRequestInfo is set, or nil.
+func RequestInfoFromRequest(req *http.Request) *RequestInfo {
+	ri, _ := req.Context().Value(reqInfoCtxKey).(*RequestInfo)
+	return ri
+}
+
+// withRequestInfo returns a copy of req with a new *RequestInfo for rn attached.
+func withRequestInfo(req *http.Request, rn *Route, path string) (*http.Request, *RequestInfo) {
+	ri := &RequestInfo{Group: rn.g, Method: req.Method, Route: rn.fp, Path: path}
+
+	req = req.WithContext(context.WithValue(req.Context(), reqInfoCtxKey, ri))
+	if req.Body != nil && req.Body != http.NoBody {
+		ri.body = &countingBody{ReadCloser: req.Body}
+		req.Body = ri.body
+	}
+	return req, ri
+}
+
+func (r *Router) requestInfoDone(ctx context.Context, ri *RequestInfo, start time.Time) {
+	ri.Duration = time.Since(start)
+	if ri.body != nil {
+		ri.BytesRead = ri.body.n.Load()
+	}
+	r.opts.OnRequestInfo(ctx, ri)
+}
@@ -6,6 +6,14 @@ func init() {
 	log.SetFlags(log.Lshortfile)
 }
 
+// ambiguousAPIRoutes are the restAPIRoutes that reuse a param position of an
+// earlier route under a different name, AddRoute rejects them with ErrAmbiguousParams.
+var ambiguousAPIRoutes = map[string]bool{
+	"/campaignTemplate/:tid/:id": true,
+	"/topN/:resource/:id":        true,
+	"/staffPick/:resource/:id":   true,
+}
+
 var restAPIRoutes = [...]struct{ url string }{
 	// conflicts
 	{
@@ -29,10 +29,15 @@ func DefaultNotFoundHandler(w http.ResponseWriter, req *http.Request, _ Params)
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	start := time.Now()
 
+	var ri *RequestInfo
 	if r.opts.CatchPanics && r.PanicHandler != nil {
 		defer func() {
 			if v := recover(); v != nil {
 				r.PanicHandler(w, req, v)
+				if ri != nil {
+					ri.Panicked = true
+					r.requestInfoDone(req.Context(), ri, start)
+				}
 			}
 		}()
 	}
@@ -40,9 +45,9 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	u, method := req.URL.Path, req.Method
 
 	if !r.opts.NoAutoCleanURL {
-		var ok bool
-		if u, ok = cleanPath(u); ok {
-			req.URL.Path = u
+		if cu, ok := cleanPath(u); ok {
+			req = withOriginalPath(req, u)
+			req.URL.Path, u = cu, cu
 		}
 	}
 
@@ -50,7 +55,12 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		w, method = &headRW{ResponseWriter: w}, http.MethodGet
 	}
 
-	if rn, p := r.match(method, pathNoQuery(u)); rn != nil && !rn.disabled.Load() {
+	rt, hp := r, (*paramsWrapper)(nil)
+	if len(r.table().hosts) > 0 {
+		rt, hp = r.matchHost(req.Host)
+	}
+
+	if rn, p := rt.matchParams(method, pathNoQuery(u), hp); rn != nil && !rn.disabled.Load() {
 		if r.opts.ProfileLabels {
 			labels := pprof.Labels("group", rn.g, "method", req.Method, "uri", req.RequestURI)
 			ctx := pprof.WithLabels(req.Context(), labels)
@@ -58,8 +68,17 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			req = req.WithContext(ctx)
 		}
 		req = req.WithContext(context.WithValue(req.Context(), routeCtxKey, rn))
+		if r.opts.OnRequestInfo != nil {
+			req, ri = withRequestInfo(req, rn, u)
+		}
+
 		rn.h(w, req, p.Params())
-		r.putParams(p)
+		rt.putParams(p)
+
+		if ri != nil {
+			r.requestInfoDone(req.Context(), ri, start)
+			ri = nil
+		}
 
 		if r.opts.OnRequestDone != nil {
 			r.opts.OnRequestDone(req.Context(), rn.g, method, u, time.Since(start))
@@ -68,17 +87,33 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if method == http.MethodGet {
-		if r.NotFoundHandler != nil {
-			r.NotFoundHandler(w, req, nil)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
+	if (r.opts.RedirectTrailingSlash || r.opts.RedirectFixedPath) && req.Method != http.MethodConnect {
+		if ru := rt.redirectPath(method, req); ru != "" {
+			redirect(w, req, ru)
+			return
 		}
-	} else {
-		if r.MethodNotAllowedHandler != nil {
+	}
+
+	if allowed := rt.allowed(method, pathNoQuery(u)); allowed != "" {
+		w.Header().Set("Allow", allowed)
+		switch {
+		case req.Method == http.MethodOptions && r.opts.AutoOptions:
+			if r.OptionsHandler != nil {
+				r.OptionsHandler(w, req, nil)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+		case r.MethodNotAllowedHandler != nil:
 			r.MethodNotAllowedHandler(w, req, nil)
-		} else {
+		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
+		return
+	}
+
+	if r.NotFoundHandler != nil {
+		r.NotFoundHandler(w, req, nil)
+	} else {
+		w.WriteHeader(http.StatusNotFound)
 	}
 }
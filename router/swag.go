@@ -40,6 +40,7 @@ type SwaggerParam struct {
 
 type SwaggerDefinition struct {
 	Type       string   `json:"type,omitempty"`
+	Format     string   `json:"format,omitempty"`
 	Required   []string `json:"required,omitempty"`
 	Properties any      `json:"properties,omitempty"`
 	Items      any      `json:"items,omitempty"`
@@ -190,10 +191,21 @@ func (r *Router) addRouteInfo(method, path string, desc *SwaggerRoute) *SwaggerR
 	if desc == nil {
 		desc = &SwaggerRoute{}
 	}
-	m[strings.ToLower(method)] = desc
+	m[swaggerMethod(method)] = desc
 	return desc
 }
 
+// swaggerMethod returns the lowercase method for the standard methods,
+// others aren't supported by OpenAPI so they get added as extensions, ex: `x-propfind`.
+func swaggerMethod(method string) string {
+	switch method = strings.ToLower(method); method {
+	case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+		return method
+	default:
+		return "x-" + method
+	}
+}
+
 func (r *Router) Swagger() *Swagger {
 	return &r.swagger
 }
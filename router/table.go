@@ -0,0 +1,152 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+)
+
+// table is the router's routing state, it's never modified once it's stored,
+// writers clone it under Router.mu and swap it, so lookups don't need any locks.
+type table struct {
+	methods [9]*node
+	custom  []methodTree // any other methods, ex: PROPFIND
+	// routes is append-only, only the latest table is ever updated, so appending can't touch what older tables see,
+	// anything else must be cloned first.
+	routes    []*Route
+	names     map[string]*Route
+	hosts     []*hostRouter
+	maxParams int
+}
+
+// clone returns a shallow copy of t, so updates cost O(changes) rather than O(routes),
+// the slices and maps must be cloned before they're modified, except for appending to routes,
+// and the trees are copied as they're modified, see getTree.
+func (t *table) clone() *table {
+	nt := *t
+	return &nt
+}
+
+// stdMethods is the order of the methods in table.methods.
+var stdMethods = [...]string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+type methodTree struct {
+	method string
+	root   *node
+}
+
+// trees returns all the non-empty method trees, standard methods first.
+func (t *table) trees() []methodTree {
+	out := make([]methodTree, 0, len(t.methods)+len(t.custom))
+	for i, n := range &t.methods {
+		if n != nil {
+			out = append(out, methodTree{stdMethods[i], n})
+		}
+	}
+	return append(out, t.custom...)
+}
+
+// getTree returns the tree for method, if create is set, it returns a copy of the root that's safe to modify,
+// see node.insert, which should only be used on a cloned table.
+func (t *table) getTree(method string, create bool) *node {
+	var n **node
+	switch method {
+	case http.MethodGet:
+		n = &t.methods[0]
+	case http.MethodHead:
+		n = &t.methods[1]
+	case http.MethodPost:
+		n = &t.methods[2]
+	case http.MethodPut:
+		n = &t.methods[3]
+	case http.MethodPatch:
+		n = &t.methods[4]
+	case http.MethodDelete:
+		n = &t.methods[5]
+	case http.MethodConnect:
+		n = &t.methods[6]
+	case http.MethodOptions:
+		n = &t.methods[7]
+	case http.MethodTrace:
+		n = &t.methods[8]
+	default:
+		if create {
+			t.custom = slices.Clone(t.custom)
+		}
+		for i := range t.custom {
+			if mt := &t.custom[i]; mt.method == method {
+				n = &mt.root
+				break
+			}
+		}
+		if n == nil {
+			if !create {
+				return nil
+			}
+			t.custom = append(t.custom, methodTree{method: method})
+			n = &t.custom[len(t.custom)-1].root
+		}
+	}
+
+	if create {
+		if *n == nil {
+			*n = &node{}
+		} else {
+			*n = (*n).copy()
+		}
+	}
+
+	return *n
+}
+
+// rebuildTree replaces the tree for method with a new one built from the table's routes.
+func (t *table) rebuildTree(method string) {
+	var n *node
+	for _, rn := range t.routes {
+		if rn.m != method {
+			continue
+		}
+		if n == nil {
+			n = &node{}
+		}
+		n.insert(rn.pp, rn)
+	}
+
+	for i, m := range stdMethods {
+		if m == method {
+			t.methods[i] = n
+			return
+		}
+	}
+
+	t.custom = slices.DeleteFunc(slices.Clone(t.custom), func(mt methodTree) bool { return mt.method == method })
+	if n != nil {
+		t.custom = append(t.custom, methodTree{method, n})
+	}
+}
+
+// update clones the current table, passes it to fn and stores it if fn doesn't return an error.
+func (r *Router) update(fn func(t *table) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.table().clone()
+	if err := fn(t); err != nil {
+		return err
+	}
+	r.t.Store(t)
+	return nil
+}
+
+func (r *Router) table() *table {
+	return r.t.Load()
+}
@@ -0,0 +1,278 @@
+package router
+
+import (
+	"slices"
+	"strings"
+)
+
+// node is a compressed radix tree node, lookups prefer static children, then params, then stars,
+// and backtrack if a branch doesn't lead to a route.
+type node struct {
+	path  string // static: the compressed path, param/star: the original part, ex: `:id<int>`
+	name  string // param/star name
+	cons  *constraint
+	route *Route
+
+	indices  string  // first byte of each static child
+	children []*node // static children
+	params   []*node // constrained params first, unconstrained params last
+	stars    []*node // same as params
+}
+
+// shape returns the route's path with the param names stripped, routes with the same shape can never be told apart.
+func shape(pp string, parts []nodePart) string {
+	var sb strings.Builder
+	sb.WriteString(pp)
+	for _, np := range parts {
+		if t := np.Type(); t != '/' {
+			sb.WriteByte('/')
+			sb.WriteByte(t)
+			if c := np.Constraint(); c != "" {
+				sb.WriteString("<" + c + ">")
+			}
+			continue
+		}
+		sb.WriteString(string(np))
+	}
+	return sb.String()
+}
+
+func samePartNames(a, b []nodePart) bool {
+	for i := range a {
+		if a[i].Name() != b[i].Name() {
+			return false
+		}
+	}
+	return true
+}
+
+// insert adds rn to the tree, pp is the static prefix and parts are the rest of the route as returned by splitPathToParts.
+// n must be safe to modify, ex: a copy returned by getTree, the nodes on the way to rn are copied before they're modified,
+// so the rest of the tree is shared with the previous table.
+// It returns the existing param node if a param has a different name than an existing one at the same position.
+func (n *node) insert(pp string, rn *Route) (conflict *node) {
+	if len(rn.parts) > 0 && !strings.HasSuffix(pp, "/") {
+		pp += "/"
+	}
+
+	n = n.addStatic(pp)
+	for i, np := range rn.parts {
+		var c *constraint
+		if rn.cons != nil {
+			c = rn.cons[i]
+		}
+
+		t := np.Type()
+		if t != '/' && i > 0 {
+			// params are always preceded by a separator
+			n = n.addStatic("/")
+		}
+
+		switch t {
+		case ':':
+			if n, conflict = n.addParam(&n.params, np, c); conflict != nil {
+				return conflict
+			}
+		case '*':
+			n, _ = n.addParam(&n.stars, np, c)
+		default:
+			n = n.addStatic(string(np))
+		}
+	}
+
+	n.route = rn
+	return nil
+}
+
+// copy returns a shallow copy of n that's safe to modify, the children are shared.
+func (n *node) copy() *node {
+	c := *n
+	c.children = slices.Clone(n.children)
+	c.params = slices.Clone(n.params)
+	c.stars = slices.Clone(n.stars)
+	return &c
+}
+
+// addStatic walks (and creates if needed) the static nodes for s and returns the node ending exactly at s.
+func (n *node) addStatic(s string) *node {
+	for s != "" {
+		i := strings.IndexByte(n.indices, s[0])
+		if i == -1 {
+			c := &node{path: s}
+			n.indices += s[:1]
+			n.children = append(n.children, c)
+			return c
+		}
+
+		c := n.children[i].copy()
+		n.children[i] = c
+		l := commonPrefix(c.path, s)
+		if l < len(c.path) {
+			child := *c
+			child.path = c.path[l:]
+			*c = node{path: c.path[:l], indices: child.path[:1], children: []*node{&child}}
+		}
+		n, s = c, s[l:]
+	}
+	return n
+}
+
+// addParam returns the param node for np, or the conflicting node if there's one with the same constraint and a different name,
+// since a request would match both and only one of the names would be set.
+func (n *node) addParam(nodes *[]*node, np nodePart, c *constraint) (_, conflict *node) {
+	name := np.Name()
+	for i, pn := range *nodes {
+		if pn.cons.String() != c.String() {
+			continue
+		}
+		if pn.name != name {
+			return nil, pn
+		}
+		pn = pn.copy()
+		(*nodes)[i] = pn
+		return pn, nil
+	}
+
+	pn := &node{path: string(np), name: name, cons: c}
+	ns := *nodes
+	i := len(ns)
+	if c != nil {
+		// keep the unconstrained params last
+		for i > 0 && ns[i-1].cons == nil {
+			i--
+		}
+	}
+	ns = append(ns, nil)
+	copy(ns[i+1:], ns[i:])
+	ns[i] = pn
+	*nodes = ns
+	return pn, nil
+}
+
+// anyRoute returns the first route found under n.
+func (n *node) anyRoute() *Route {
+	if n.route != nil {
+		return n.route
+	}
+	for _, ns := range [...][]*node{n.children, n.params, n.stars} {
+		for _, c := range ns {
+			if rn := c.anyRoute(); rn != nil {
+				return rn
+			}
+		}
+	}
+	return nil
+}
+
+// lookup matches the rest of the path after n, appending params to ps.
+// If fold is set, static parts are matched ignoring ASCII case.
+func (n *node) lookup(path string, ps *paramsWrapper, fold bool) *Route {
+	if path == "" {
+		if n.route != nil {
+			return n.route
+		}
+
+		// `/files/*path` matches `/files/` and `/files`
+		if rn := n.matchStar(path, ps); rn != nil {
+			return rn
+		}
+		if i := strings.IndexByte(n.indices, '/'); i != -1 && n.children[i].path == "/" {
+			return n.children[i].matchStar(path, ps)
+		}
+		return nil
+	}
+
+	if !fold {
+		if i := strings.IndexByte(n.indices, path[0]); i != -1 {
+			if rn := n.children[i].lookupStatic(path, ps, false); rn != nil {
+				return rn
+			}
+		}
+	} else {
+		for i := 0; i < len(n.indices); i++ {
+			if toLower(n.indices[i]) != toLower(path[0]) {
+				continue
+			}
+			if rn := n.children[i].lookupStatic(path, ps, true); rn != nil {
+				return rn
+			}
+		}
+	}
+
+	if len(n.params) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end == -1 {
+			end = len(path)
+		}
+
+		if v := path[:end]; v != "" {
+			for _, c := range n.params {
+				if !c.cons.allows(v) {
+					continue
+				}
+
+				l := len(ps.p)
+				ps.p = append(ps.p, Param{c.name, v})
+				if rn := c.lookup(path[end:], ps, fold); rn != nil {
+					return rn
+				}
+				ps.p = ps.p[:l]
+			}
+		}
+	}
+
+	return n.matchStar(path, ps)
+}
+
+// lookupStatic matches path against the static node n.
+func (n *node) lookupStatic(path string, ps *paramsWrapper, fold bool) *Route {
+	l := len(n.path)
+	if len(path) >= l && equalPath(path[:l], n.path, fold) {
+		return n.lookup(path[l:], ps, fold)
+	}
+
+	if len(path) == l-1 && n.path[l-1] == '/' && equalPath(path, n.path[:l-1], fold) {
+		return n.matchStar("", ps)
+	}
+
+	return nil
+}
+
+func (n *node) matchStar(path string, ps *paramsWrapper) *Route {
+	for _, c := range n.stars {
+		if c.route != nil && c.cons.allows(path) {
+			ps.p = append(ps.p, Param{c.name, path})
+			return c.route
+		}
+	}
+	return nil
+}
+
+func equalPath(a, b string, fold bool) bool {
+	if !fold {
+		return a == b
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if toLower(a[i]) != toLower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+func commonPrefix(a, b string) (i int) {
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+)
+
+// Name names the route so it can be used with Router.URLFor, it panics if the name is already used by another route.
+// Names are shared between the router and its host routers.
+func (n *Route) Name(name string) *Route {
+	r := n.r.top()
+
+	r.update(func(t *table) error {
+		if on := t.names[name]; on != nil && on != n {
+			panic(fmt.Sprintf("router: route name %q is already used by %s %s", name, on.m, on.fp))
+		}
+
+		t.names = maps.Clone(t.names)
+		if t.names == nil {
+			t.names = map[string]*Route{}
+		}
+
+		if old := n.routeName(); old != "" {
+			delete(t.names, old)
+		}
+
+		n.name.Store(&name)
+		t.names[name] = n
+		return nil
+	})
+	return n
+}
+
+func (n *Route) routeName() string {
+	if name := n.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+// URLFor returns the escaped path of the named route, params are key/value pairs, ex:
+//
+//	r.URLFor("user.show", "id", "42") // /users/42
+//
+// Params that aren't part of the route are ignored.
+func (r *Router) URLFor(name string, params ...string) (string, error) {
+	rn := r.top().table().names[name]
+	if rn == nil {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRoute, name)
+	}
+	return rn.URL(params...)
+}
+
+// URL returns the escaped path of the route using the passed key/value params.
+func (n *Route) URL(params ...string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("router: odd number of params passed for %s", n.fp)
+	}
+
+	get := func(name string) (string, bool) {
+		for i := 0; i < len(params); i += 2 {
+			if params[i] == name {
+				return params[i+1], true
+			}
+		}
+		return "", false
+	}
+
+	var sb strings.Builder
+	sb.WriteString(n.pp)
+	if len(n.parts) > 0 && !strings.HasSuffix(n.pp, "/") {
+		sb.WriteByte('/')
+	}
+
+	for i, np := range n.parts {
+		t := np.Type()
+		if t == '/' {
+			sb.WriteString(string(np))
+			continue
+		}
+
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+
+		v, ok := get(np.Name())
+		if !ok {
+			return "", fmt.Errorf("%w: %s (%s)", ErrMissingParam, np.Name(), n.fp)
+		}
+
+		if n.cons != nil && !n.cons[i].allows(v) {
+			return "", fmt.Errorf("%w: %s=%q (%s)", ErrInvalidParam, np.Name(), v, n.fp)
+		}
+
+		switch t {
+		case ':':
+			if v == "" {
+				return "", fmt.Errorf("%w: %s (%s)", ErrMissingParam, np.Name(), n.fp)
+			}
+			sb.WriteString(url.PathEscape(v))
+		case '*':
+			for j, seg := range strings.Split(v, "/") {
+				if j > 0 {
+					sb.WriteByte('/')
+				}
+				sb.WriteString(url.PathEscape(seg))
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
@@ -4,14 +4,34 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"regexp"
 	"strings"
 )
 
 type nodePart string
 
-func (np nodePart) Name() string { return string(np[1:]) }
-func (np nodePart) Type() uint8  { return np[0] }
+func (np nodePart) Name() string {
+	s := string(np[1:])
+	if np.Type() != '/' {
+		if i := strings.IndexByte(s, '<'); i != -1 {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func (np nodePart) Type() uint8 { return np[0] }
+
+// Constraint returns the raw constraint of a param part, ex: `:id<int>` returns "int".
+func (np nodePart) Constraint() string {
+	if np.Type() == '/' || np[len(np)-1] != '>' {
+		return ""
+	}
+	if i := strings.IndexByte(string(np), '<'); i != -1 {
+		return string(np[i+1 : len(np)-1])
+	}
+	return ""
+}
+
 func (np nodePart) String() string {
 	if np.Type() == '/' {
 		return fmt.Sprintf("{%s}", np.Name())
@@ -19,76 +39,60 @@ func (np nodePart) String() string {
 	return fmt.Sprintf("{%s '%c'}", np.Name(), np.Type())
 }
 
-var re = regexp.MustCompile(`([:*/]?[^:*]+)`)
-
-// splitPathToParts takes in a path (ex: /api/v1/someEndpoint/:id/*any) and returns:
+// splitPathToParts takes in a path (ex: /api/v1/someEndpoint/:id<int>/*any) and returns:
 //
-//	pp -> the longest part before the first param (/api/v1/someEndpoint/:)
-//	rest -> all the params (id, any)
+//	pp -> the longest part before the first param (/api/v1/someEndpoint/)
+//	rest -> all the params (:id<int>, *any)
 //	num -> number of params (probably not needed...)
 //	stars -> number of stars, basically a sanity check, if it's not 0 or 1 then it's an invalid path
 func splitPathToParts(p string) (pp string, rest []nodePart, num, stars int) {
-	parts := re.FindAllString(p, -1)
-	if len(parts) < 2 {
+	idx := strings.IndexAny(p, ":*")
+	if idx == -1 {
 		pp = p
 		return
 	}
 
-	pp = parts[0]
-	for _, part := range parts[1:] {
-		splitPathFn(part, '/', func(sp string, _, _ int) bool {
-			switch c := sp[0]; c {
-			case '*':
-				stars++
-				fallthrough
-			case ':':
-				num++
-				fallthrough
-			case '/':
-				rest = append(rest, nodePart(sp))
-			}
-			return false
-		})
-	}
-	return
-}
-
-func splitPathFn(s string, sep uint8, fn func(p string, pidx, idx int) bool) bool {
-	for i, pi, last := 0, 0, 0; i < len(s); i++ {
-		if s[i] != sep {
-			if i < len(s)-1 {
-				continue
-			}
-			i = len(s)
+	pp, p = p[:idx], p[idx:]
+	for p != "" {
+		if len(p) > 1 && p[0] == '/' && (p[1] == ':' || p[1] == '*') {
+			p = p[1:]
 		}
-
-		if ss := s[last:i]; ss != "" {
-			if fn(ss, pi, i) {
-				return true
+		end := partEnd(p)
+		switch np := nodePart(p[:end]); np.Type() {
+		case '*':
+			stars++
+			fallthrough
+		case ':':
+			num++
+			fallthrough
+		default:
+			if len(np) > 1 {
+				rest = append(rest, np)
 			}
-			last = i
-			pi++
 		}
+		p = p[end:]
 	}
-
-	return false
+	return
 }
 
-func revSplitPathFn(s string, sep uint8, fn func(p string, pidx, idx int) bool) bool {
-	for i, pi, last := len(s)-1, 0, len(s); i > -1; i-- {
-		if s[i] != sep {
-			continue
-		}
-		if ss := s[i:last]; ss != "" {
-			if fn(ss, pi, last) {
-				return true
+// partEnd returns the end of the first part of p, skipping over any `<...>` constraints.
+func partEnd(p string) int {
+	depth := 0
+	for i := 1; i < len(p); i++ {
+		switch p[i] {
+		case '<':
+			depth++
+		case '>':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				return i
 			}
-			last = i
-			pi++
 		}
 	}
-
-	return false
+	return len(p)
 }
 
 type headRW struct {
@@ -2,49 +2,60 @@ package router
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// MethodAny can be used as a route's method to match any method that doesn't have its own route for the path.
+const MethodAny = "*"
+
 type OnRequestDone = func(ctx context.Context, group, method, uri string, duration time.Duration)
 
 // Options passed to the router
 type Options struct {
 	OnRequestDone
+	OnRequestInfo OnRequestInfo // called after a matched route is served, see RequestInfo
 
 	APIInfo *SwaggerInfo
 
 	NoAutoCleanURL           bool // don't automatically clean URLs, not recommended
 	NoDefaultPanicHandler    bool // don't use the default panic handler
-	NoPanicOnInvalidAddRoute bool // don't panic on invalid routes, return an error instead
+	NoPanicOnInvalidAddRoute bool // don't panic on invalid routes, AddRoute returns nil instead, use TryAddRoute to get the error
 	CatchPanics              bool // don't catch panics
 	NoAutoHeadToGet          bool // disable automatically handling HEAD requests
 	ProfileLabels            bool
 	AutoGenerateSwagger      bool
-}
+	AutoOptions              bool // automatically respond to OPTIONS requests if there's no OPTIONS route for the path
 
-const (
-	// tooManyStars is returned if there are multiple *params in the path
-	tooManyStars = "too many stars"
-	// starNotLast is returned if *param is not the last part of the path.
-	starNotLast = "star param must be the last part of the path"
-)
+	// Redirects use 301 for GET and HEAD requests, and 308 for other methods so the body is kept.
+
+	// RedirectTrailingSlash redirects to the path with (or without) the trailing slash if only that one has a route.
+	RedirectTrailingSlash bool
+	// RedirectFixedPath redirects to the route matching the path case-insensitively, ex: /Users -> /users.
+	RedirectFixedPath bool
+	// MatchCaseInsensitive serves the route matching the path case-insensitively without redirecting,
+	// exact matches still take priority.
+	MatchCaseInsensitive bool
+}
 
 type Route struct {
 	r        *Router
 	m        string
 	g        string
 	fp       string
+	pp       string
+	name     atomic.Pointer[string] // set by Name under the top router's mu
 	h        Handler
 	parts    []nodePart
+	cons     []*constraint
 	disabled atomic.Bool
-}
-
-func (n *Route) hasStar() bool {
-	return len(n.parts) > 0 && n.parts[len(n.parts)-1].Type() == '*'
+	meta     atomic.Pointer[map[string]any]
 }
 
 func (n *Route) paramLen() (out int) {
@@ -69,6 +80,10 @@ func (n *Route) getPartName(i int) (np string, pi int) {
 	return
 }
 
+func (r *Route) Method() string {
+	return r.m
+}
+
 func (r *Route) Path() string {
 	return r.fp
 }
@@ -88,50 +103,57 @@ func (n *Route) WithDoc(desc string, genParams bool) *SwaggerRoute {
 
 	if genParams {
 		for _, p := range n.parts {
-			if p[0] == ':' || p[0] == '*' {
-				sr = sr.WithParam(p.Name(), p.String()+" is required", "path", "string", true, nil)
+			if p[0] != ':' && p[0] != '*' {
+				continue
 			}
+			var schema *SwaggerDefinition
+			typ := "string"
+			if c, _ := compileConstraint(p.Constraint()); c != nil {
+				typ, schema = c.typ, &SwaggerDefinition{Format: c.format}
+			}
+			sr = sr.WithParam(p.Name(), p.String()+" is required", "path", typ, true, schema)
 		}
 	}
 	n.r.addRouteInfo(n.m, n.fp, sr)
 	return sr
 }
 
-type routeMap map[string][]*Route
-
-func (rm routeMap) get(path string) []*Route {
-	return rm[path]
-}
-
-func (rm routeMap) append(path string, n *Route) {
-	rm[path] = append(rm[path], n)
-}
-
 // Router is an efficient routing library
 type Router struct {
-	methods [9]routeMap
+	t       atomic.Pointer[table]
+	mu      sync.Mutex        // serializes table updates
+	shapes  map[string]*Route // guarded by mu, see shape
 	swagger Swagger
 
+	root       *Router // the parent of a host router
+	hostParams int
+
 	pp sync.Pool
 
 	NotFoundHandler         Handler
-	MethodNotAllowedHandler Handler
+	MethodNotAllowedHandler Handler // called with the Allow header already set
+	OptionsHandler          Handler // used with Options.AutoOptions, called with the Allow header already set
 	PanicHandler            PanicHandler
 
-	opts      Options
-	maxParams int
+	opts Options
 }
 
 // New returns a new Router
 func New(opts *Options) *Router {
-	var r Router
+	return newRouter(opts, nil, 0)
+}
+
+func newRouter(opts *Options, root *Router, hostParams int) *Router {
+	r := &Router{root: root, hostParams: hostParams}
 
 	if opts != nil {
 		r.opts = *opts
 	}
 
+	r.t.Store(&table{maxParams: hostParams})
+
 	r.pp.New = func() any {
-		return &paramsWrapper{make(Params, 0, r.maxParams)}
+		return &paramsWrapper{make(Params, 0, r.table().maxParams)}
 	}
 
 	if !r.opts.NoDefaultPanicHandler {
@@ -140,63 +162,162 @@ func New(opts *Options) *Router {
 
 	r.swagger.OpenAPI = "3.0.3"
 	r.swagger.Info = r.opts.APIInfo
-	return &r
+	return r
 }
 
+// GetRoutes returns all the registered routes in the order of group name, method, path.
 func (r *Router) GetRoutes() [][3]string {
-	rms := r.getAllMaps()
-	routes := make([][3]string, 0, len(rms))
-	for method, rm := range rms {
-		for p, ns := range rm {
-			base := p
-			for _, n := range ns {
-				route := base
-				for _, np := range n.parts {
-					route += "/" + string(np)
-				}
-				routes = append(routes, [3]string{n.g, method, route})
-			}
-		}
+	rs := r.table().routes
+	routes := make([][3]string, 0, len(rs))
+	for _, rn := range rs {
+		routes = append(routes, [3]string{rn.g, rn.m, rn.fp})
 	}
 	return routes
 }
 
 // AddRoute adds a Handler to the specific method and route.
-// Calling AddRoute after starting the http server is racy and not supported.
+// It's safe to call while serving requests.
 func (r *Router) AddRoute(group, method, route string, h Handler) *Route {
 	return r.AddRouteWithDesc(group, method, route, h, "")
 }
 
 // AddRoute adds a Handler to the specific method and route.
-// Calling AddRoute after starting the http server is racy and not supported.
+// It's safe to call while serving requests, in-flight requests keep using the previous routes.
+// Static parts always take priority over params, and params over stars, regardless of the order of registration.
+// It panics if the route is invalid, unless Options.NoPanicOnInvalidAddRoute is set, in which case it returns nil.
 func (r *Router) AddRouteWithDesc(group, method, route string, h Handler, desc string) *Route {
-	p, rest, num, stars := splitPathToParts(route)
+	rn, err := r.tryAddRoute(group, method, route, h, desc)
+	if err != nil && !r.opts.NoPanicOnInvalidAddRoute {
+		panic(err)
+	}
+	return rn
+}
+
+// TryAddRoute is like AddRoute, but returns a *RouteError instead of panicking if the route is invalid,
+// or if it conflicts with an already registered route.
+func (r *Router) TryAddRoute(group, method, route string, h Handler) (*Route, error) {
+	return r.tryAddRoute(group, method, route, h, "")
+}
+
+// parseRoute splits route into its static prefix and the rest of its parts.
+func parseRoute(route string) (p string, rest []nodePart, num, stars int) {
+	p, rest, num, stars = splitPathToParts(route)
+	if n := len(p) - 1; len(p) > 1 && p[n] == '/' {
+		p = p[:n]
+	}
+	return
+}
+
+func (r *Router) tryAddRoute(group, method, route string, h Handler, desc string) (*Route, error) {
+	routeErr := func(err error, conflict, reason string) error {
+		return &RouteError{Err: err, Method: method, Path: route, Conflict: conflict, Reason: reason}
+	}
+
+	if !validMethod(method) {
+		return nil, routeErr(ErrInvalidMethod, "", "")
+	}
+
+	p, rest, num, stars := parseRoute(route)
 	if stars > 1 {
-		panic(tooManyStars)
+		return nil, routeErr(ErrTooManyStars, "", "")
 	}
 
 	if stars == 1 && rest[len(rest)-1].Type() != '*' {
-		panic(starNotLast)
+		return nil, routeErr(ErrStarNotLast, "", "")
 	}
 
-	if n := len(p) - 1; len(p) > 1 && p[n] == '/' {
-		p = p[:n]
+	var cons []*constraint
+	for i, np := range rest {
+		c, err := compileConstraint(np.Constraint())
+		if err != nil {
+			return nil, routeErr(ErrInvalidConstraint, "", err.Error())
+		}
+		if c == nil {
+			continue
+		}
+		if cons == nil {
+			cons = make([]*constraint, len(rest))
+		}
+		cons[i] = c
 	}
 
-	m := r.getMap(method, true)
-	n := &Route{r: r, fp: route, g: group, m: method, h: h, parts: rest}
-	m.append(p, n)
+	n := &Route{r: r, fp: route, pp: p, g: group, m: method, h: h, parts: rest, cons: cons}
+	key := method + " " + shape(p, rest)
+	err := r.update(func(t *table) error {
+		if on := r.shapes[key]; on != nil {
+			switch {
+			case samePartNames(on.parts, rest):
+				return routeErr(ErrDuplicateRoute, on.fp, "")
+			case stars == 1 && samePartNames(on.parts[:len(rest)-1], rest[:len(rest)-1]):
+				return routeErr(ErrShadowedRoute, on.fp, "")
+			default:
+				return routeErr(ErrAmbiguousParams, on.fp, "")
+			}
+		}
+
+		if cn := t.getTree(method, true).insert(p, n); cn != nil {
+			var conflict string
+			if rn := cn.anyRoute(); rn != nil {
+				conflict = rn.fp
+			}
+			return routeErr(ErrAmbiguousParams, conflict, "param "+cn.path+" is already registered at the same position")
+		}
+		t.routes = append(t.routes, n)
+		if r.shapes == nil {
+			r.shapes = map[string]*Route{}
+		}
+		r.shapes[key] = n
 
-	if num > r.maxParams {
-		r.maxParams = num
+		if num += r.hostParams; num > t.maxParams {
+			t.maxParams = num
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	if desc != "" && r.opts.AutoGenerateSwagger {
 		n.WithDoc(desc, r.opts.AutoGenerateSwagger)
 	}
-	return n
+	return n, nil
 }
 
+// RemoveRoute removes the route for method and route, route must have the same param names as the registered one.
+// It's safe to call while serving requests, in-flight requests keep using the previous routes.
+// It returns false if there's no such route.
+func (r *Router) RemoveRoute(method, route string) bool {
+	p, rest, _, _ := parseRoute(route)
+	key := method + " " + shape(p, rest)
+
+	var rn *Route
+	if err := r.update(func(t *table) error {
+		if rn = r.shapes[key]; rn == nil || !samePartNames(rn.parts, rest) {
+			return errNoRoute
+		}
+
+		delete(r.shapes, key)
+		t.routes = slices.DeleteFunc(slices.Clone(t.routes), func(o *Route) bool { return o == rn })
+		t.rebuildTree(method)
+		return nil
+	}); err != nil {
+		return false
+	}
+
+	if name := rn.routeName(); name != "" {
+		r.top().update(func(t *table) error {
+			if t.names[name] == rn {
+				t.names = maps.Clone(t.names)
+				delete(t.names, name)
+			}
+			return nil
+		})
+	}
+	return true
+}
+
+var errNoRoute = errors.New("no route")
+
 // Match matches a method and path to a handler.
 // if METHOD == HEAD and there isn't a specific handler for it, it returns the GET handler for the path.
 func (r *Router) Match(method, path string) (rn *Route, params Params) {
@@ -218,127 +339,100 @@ func (r *Router) DisableRoute(method, path string, disabled bool) bool {
 }
 
 func (r *Router) match(method, path string) (rn *Route, params *paramsWrapper) {
-	m := r.getMap(method, false)
+	return r.matchParams(method, path, nil)
+}
+
+// matchParams is like match, but appends to params if it isn't nil, used for host params.
+// If there's no route for method, the routes registered for MethodAny are tried.
+func (r *Router) matchParams(method, path string, params *paramsWrapper) (rn *Route, _ *paramsWrapper) {
+	t := r.table()
+	if params == nil && t.maxParams > 0 {
+		params = r.getParams()
+	}
+
+	rn = r.lookup(t.getTree(method, false), path, params)
+	if rn == nil && method != MethodAny {
+		rn = r.lookup(t.getTree(MethodAny, false), path, params)
+	}
+
+	if rn == nil || len(params.Params()) == 0 {
+		r.putParams(params)
+		params = nil
+	}
+
+	return rn, params
+}
+
+func (r *Router) lookup(n *node, path string, params *paramsWrapper) (rn *Route) {
+	if n == nil {
+		return nil
+	}
+	if rn = n.lookup(path, params, false); rn == nil && r.opts.MatchCaseInsensitive {
+		rn = n.lookup(path, params, true)
+	}
+	return rn
+}
+
+// allowed returns a comma separated list of the methods that have a route matching path, skipping method.
+func (r *Router) allowed(method, path string) string {
 	var (
-		nn   []*Route
-		nsep int
+		ms      []string
+		options bool
+		t       = r.table()
 	)
 
-	if !revSplitPathFn(path, '/', func(p string, pidx, idx int) bool {
-		if nn = m.get(path[:idx]); nn != nil {
-			path, nsep = path[idx:], pidx
-			return true
+	for _, mt := range t.trees() {
+		m, n := mt.method, mt.root
+		if m == method || m == MethodAny || (m == http.MethodHead && !r.opts.NoAutoHeadToGet) {
+			continue
 		}
 
-		return false
-	}) {
-		if nn = m.get("/"); nn != nil {
-			nsep = strings.Count(path, "/")
-		} else {
-			return
+		var ps *paramsWrapper
+		if t.maxParams > 0 {
+			ps = r.getParams()
 		}
-	}
+		rn := n.lookup(path, ps, false)
+		if rn == nil && r.opts.MatchCaseInsensitive {
+			rn = n.lookup(path, ps, true)
+		}
+		r.putParams(ps)
 
-	for _, n := range nn {
-		if n.hasStar() {
-			rn = n
-			break
+		if rn == nil || rn.disabled.Load() {
+			continue
 		}
-		if len(n.parts) == nsep {
-			if splitPathFn(path, '/', func(p string, pidx, idx int) bool {
-				np := n.parts[pidx]
-				if np.Type() == ':' {
-					return false
-				}
-				if string(np) != p {
-					return true
-				}
-
-				return false
-			}) {
-				continue
+
+		ms = append(ms, m)
+		switch m {
+		case http.MethodGet:
+			if !r.opts.NoAutoHeadToGet {
+				ms = append(ms, http.MethodHead)
 			}
-			rn = n
-			break
+		case http.MethodOptions:
+			options = true
 		}
 	}
 
-	if rn == nil || len(rn.parts) == 0 {
-		return
+	if len(ms) > 0 && r.opts.AutoOptions && !options {
+		ms = append(ms, http.MethodOptions)
 	}
 
-	params = r.getParams()
-	splitPathFn(path, '/', func(p string, pidx, idx int) bool {
-		np := rn.parts[pidx]
-		switch np.Type() {
-		case ':':
-			params.p = append(params.p, Param{np.Name(), p[1:]})
-		case '*':
-			params.p = append(params.p, Param{np.Name(), path[1:]})
-			return true
-		}
-		return false
-	})
-
-	return
-}
-
-func (r *Router) getAllMaps() map[string]routeMap {
-	out := make(map[string]routeMap)
-	for i, rm := range &r.methods {
-		switch i {
-		case 0:
-			out[http.MethodGet] = rm
-		case 1:
-			out[http.MethodHead] = rm
-		case 2:
-			out[http.MethodPost] = rm
-		case 3:
-			out[http.MethodPut] = rm
-		case 4:
-			out[http.MethodPatch] = rm
-		case 5:
-			out[http.MethodDelete] = rm
-		case 6:
-			out[http.MethodConnect] = rm
-		case 7:
-			out[http.MethodOptions] = rm
-		case 8:
-			out[http.MethodTrace] = rm
-		}
-	}
-	return out
+	return strings.Join(ms, ", ")
 }
 
-func (r *Router) getMap(method string, create bool) routeMap {
-	var rm *routeMap
-	switch method {
-	case http.MethodGet:
-		rm = &r.methods[0]
-	case http.MethodHead:
-		rm = &r.methods[1]
-	case http.MethodPost:
-		rm = &r.methods[2]
-	case http.MethodPut:
-		rm = &r.methods[3]
-	case http.MethodPatch:
-		rm = &r.methods[4]
-	case http.MethodDelete:
-		rm = &r.methods[5]
-	case http.MethodConnect:
-		rm = &r.methods[6]
-	case http.MethodOptions:
-		rm = &r.methods[7]
-	case http.MethodTrace:
-		rm = &r.methods[8]
-	default:
-		return nil
+// validMethod returns true if m is a valid RFC 7230 token.
+func validMethod(m string) bool {
+	if m == "" {
+		return false
 	}
-	if create && *rm == nil {
-		*rm = routeMap{}
+	for i := 0; i < len(m); i++ {
+		switch c := m[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1:
+		default:
+			return false
+		}
 	}
-
-	return *rm
+	return true
 }
 
 func (r *Router) getParams() *paramsWrapper {
@@ -347,7 +441,7 @@ func (r *Router) getParams() *paramsWrapper {
 }
 
 func (r *Router) putParams(p *paramsWrapper) {
-	if p == nil || cap(p.p) != r.maxParams {
+	if p == nil || cap(p.p) != r.table().maxParams {
 		return
 	}
 	p.p = p.p[:0]
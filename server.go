@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -22,6 +23,12 @@ import (
 )
 
 var DefaultPanicHandler = func(ctx *Context, v any, fr *oerrs.Frame) {
+	if ctx.s.opts.SLogger != nil {
+		ctx.Logger().Error("panic", "panic", fmt.Sprint(v), "function", fr.Function, "file", fr.File, "line", fr.Line)
+		ctx.Encode(500, NewJSONErrorResponse(500, "internal server error"))
+		return
+	}
+
 	msg, info := fmt.Sprintf("PANIC in %s %s: %v", ctx.Req.Method, ctx.Path(), v), fmt.Sprintf("at %s %s:%d", fr.Function, fr.File, fr.Line)
 	ctx.Logf("%s (%s)", msg, info)
 	resp := NewJSONErrorResponse(500, "internal server error")
@@ -83,7 +90,21 @@ func NewWithOpts(opts *Options) *Server {
 		})
 	}
 
-	srv.s = srv
+	srv.r.MethodNotAllowedHandler = func(w http.ResponseWriter, req *http.Request, p router.Params) {
+		if h := srv.MethodNotAllowedHandler; h != nil {
+			ctx := getCtx(w, req, p, srv)
+			srv.MethodNotAllowedHandler(ctx)
+			putCtx(ctx)
+			return
+		}
+
+		RespMethodNotAllowed.WriteToCtx(&Context{
+			Req:            req,
+			ResponseWriter: w,
+		})
+	}
+
+	srv.s, srv.Group.r = srv, srv.r
 
 	return srv
 }
@@ -98,7 +119,10 @@ type Server struct {
 	r *router.Router
 
 	PanicHandler
-	NotFoundHandler func(ctx *Context)
+	NotFoundHandler         func(ctx *Context)
+	MethodNotAllowedHandler func(ctx *Context) // the Allow header is already set when it gets called
+
+	chains sync.Map // Route -> *groupHandlerChain, used by RoutesInfo
 
 	servers    []*http.Server
 	opts       Options
@@ -205,11 +229,11 @@ func (s *Server) Logf(f string, args ...any) {
 }
 
 func (s *Server) logfStack(n int, f string, args ...any) {
-	lg := s.opts.Logger
-	if lg == nil {
-		lg = log.Default()
-	}
+	s.logStack(n+1, nil, f, args...)
+}
 
+// logStack logs to sl if it isn't nil and the server has a structured logger, otherwise it uses the server's loggers.
+func (s *Server) logStack(n int, sl *slog.Logger, f string, args ...any) {
 	_, file, line, ok := runtime.Caller(n + 1)
 	if !ok {
 		file = "???"
@@ -221,8 +245,30 @@ func (s *Server) logfStack(n int, f string, args ...any) {
 	if len(parts) > 2 {
 		parts = parts[len(parts)-2:]
 	}
+	src := strings.Join(parts, "/") + ":" + strconv.Itoa(line)
 
-	lg.Printf(strings.Join(parts, "/")+":"+strconv.Itoa(line)+": "+f, args...)
+	if s.opts.SLogger != nil {
+		if sl == nil {
+			sl = s.opts.SLogger
+		}
+		sl.Info(fmt.Sprintf(f, args...), "source", src)
+		return
+	}
+
+	lg := s.opts.Logger
+	if lg == nil {
+		lg = log.Default()
+	}
+
+	lg.Printf(src+": "+f, args...)
+}
+
+// SLogger returns the server's structured logger, or slog.Default() if it isn't set.
+func (s *Server) SLogger() *slog.Logger {
+	if s.opts.SLogger != nil {
+		return s.opts.SLogger
+	}
+	return slog.Default()
 }
 
 // AllowCORS is an alias for s.AddRoute("OPTIONS", path, AllowCORS(allowedMethods...))
@@ -230,6 +276,45 @@ func (s *Server) AllowCORS(path string, allowedMethods ...string) {
 	s.AddRoute(http.MethodOptions, path, AllowCORS(allowedMethods, nil, nil))
 }
 
+// URLFor returns the escaped path of a route named with Route.Name, params are key/value pairs, ex:
+//
+//	s.GET("/users/:id", h).Name("user.show")
+//	u, err := s.URLFor("user.show", "id", "42") // /users/42
+func (s *Server) URLFor(name string, params ...string) (string, error) {
+	return s.r.URLFor(name, params...)
+}
+
+// Host returns a group that only serves requests for the host pattern, see router.Router.Host, ex:
+//
+//	api := s.Host("api.example.com")
+//	tenants := s.Host(":tenant.example.com") // ctx.Param("tenant")
+//
+// Requests that don't match any host are served by the server's own routes.
+func (s *Server) Host(pattern string, mw ...Handler) *Group {
+	g := s.SubGroup(pattern, "", mw...)
+	g.r = s.r.Host(pattern)
+	return g
+}
+
+// Hosts returns the registered host patterns.
+func (s *Server) Hosts() []string {
+	return s.r.Hosts()
+}
+
+// AutoCertHosts returns an AutoCertHosts with the registered exact hosts and any extra hosts,
+// wildcard patterns are skipped since they can't be verified by autocert, ex:
+//
+//	s.RunAutoCertDyn(ctx, "", s.AutoCertHosts("example.com").IsAllowed)
+func (s *Server) AutoCertHosts(extra ...string) *AutoCertHosts {
+	hosts := extra[:len(extra):len(extra)]
+	for _, h := range s.r.Hosts() {
+		if !strings.ContainsAny(h, ":*") {
+			hosts = append(hosts, h)
+		}
+	}
+	return NewAutoCertHosts(hosts...)
+}
+
 func (s *Server) Swagger() *router.Swagger {
 	return s.r.Swagger()
 }
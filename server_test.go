@@ -3,17 +3,29 @@ package gserv
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"go.oneofone.dev/gserv/router"
+	"go.oneofone.dev/gserv/trace"
+	"go.oneofone.dev/oerrs"
 	"go.oneofone.dev/otk"
 )
 
@@ -335,3 +347,1487 @@ func TestListenZero(t *testing.T) {
 	s := newServerAndWait(t, "")
 	defer s.Shutdown(0)
 }
+
+func TestMethodNotAllowed(t *testing.T) {
+	srv := New(SetErrLogger(nil), SetAutoOptions(true))
+	JSONGet(srv, "/ping", func(ctx *Context) (string, error) {
+		return "pong", nil
+	}, true)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+"/ping", MimeJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp JSONResponse
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusMethodNotAllowed || resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d %+v", res.StatusCode, resp)
+	}
+
+	if a := res.Header.Get("Allow"); a != "GET, HEAD, OPTIONS" {
+		t.Fatalf("unexpected Allow header: %q", a)
+	}
+
+	if res, err = http.Post(ts.URL+"/pong", MimeJSON, nil); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.StatusCode)
+	}
+}
+
+func TestCustomMethods(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	g := srv.SubGroup("dav", "/dav")
+	g.AddRoute("PROPFIND", "/*path", func(ctx *Context) Response {
+		return NewJSONResponse(ctx.Param("path"))
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("PROPFIND", ts.URL+"/dav/a/b", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s string
+	if _, err = ReadJSONResponse(res.Body, &s); err != nil || s != "a/b" {
+		t.Fatalf("expected a/b, got %q %v", s, err)
+	}
+
+	if rs := srv.Routes(); len(rs) != 1 || rs[0] != [3]string{"dav", "PROPFIND", "/dav/*path"} {
+		t.Fatalf("unexpected routes: %v", rs)
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	g := srv.SubGroup("users", "/api/v1").SubGroup("", "users")
+	g.GET("/:id", func(ctx *Context) Response {
+		return NewJSONResponse(ctx.Param("id"))
+	}).Name("user.show")
+
+	srv.GET("/me", func(ctx *Context) Response {
+		u, err := ctx.URLFor("user.show", "id", "me")
+		if err != nil {
+			return NewJSONErrorResponse(http.StatusInternalServerError, err)
+		}
+		return Redirect(u, false)
+	})
+
+	if _, err := srv.URLFor("user.show"); !errors.Is(err, router.ErrMissingParam) {
+		t.Fatalf("expected ErrMissingParam, got %v", err)
+	}
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/me")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s string
+	if _, err = ReadJSONResponse(res.Body, &s); err != nil || s != "me" || res.Request.URL.Path != "/api/v1/users/me" {
+		t.Fatalf("unexpected response: %q %v %s", s, err, res.Request.URL)
+	}
+}
+
+func TestHost(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/", func(ctx *Context) Response { return NewJSONResponse("default") })
+	srv.Host("api.example.com").GET("/", func(ctx *Context) Response { return NewJSONResponse("api") })
+	srv.Host(":tenant.example.com").GET("/", func(ctx *Context) Response { return NewJSONResponse(ctx.Param("tenant")) })
+
+	for host, exp := range map[string]string{
+		"example.com":          "default",
+		"api.example.com":      "api",
+		"API.example.com:8080": "api",
+		"acme.example.com":     "acme",
+		"a.b.example.com":      "default",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+
+		var s string
+		if _, err := ReadJSONResponse(rr.Result().Body, &s); err != nil || s != exp {
+			t.Errorf("%s: expected %q, got %q (%v)", host, exp, s, err)
+		}
+	}
+
+	ach := srv.AutoCertHosts("example.com")
+	if !ach.Contains("api.example.com") || !ach.Contains("example.com") || ach.Contains("acme.example.com") {
+		t.Fatalf("unexpected autocert hosts: %v", ach.m)
+	}
+}
+
+func TestRemoveRoute(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	g := srv.SubGroup("plugin", "/plugin")
+	g.GET("/ping", func(ctx *Context) Response { return NewJSONResponse("pong") })
+
+	get := func() int {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/plugin/ping", nil))
+		return rr.Code
+	}
+
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if !g.RemoveRoute(http.MethodGet, "/ping") || g.RemoveRoute(http.MethodGet, "/ping") {
+		t.Fatal("expected the route to be removed once")
+	}
+
+	if code := get(); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+}
+
+func TestMount(t *testing.T) {
+	inner := New(SetErrLogger(nil))
+	inner.GET("/users/:id", func(ctx *Context) Response {
+		return NewJSONResponse(ctx.Req.Header.Get("X-Forwarded-Prefix") + " " + ctx.Path() + " " + ctx.Param("id"))
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Method+" "+req.Header.Get("X-Forwarded-Prefix")+" "+req.URL.Path)
+	})
+
+	srv := New(SetErrLogger(nil))
+	g := srv.SubGroup("admin", "/admin", func(ctx *Context) Response {
+		ctx.Header().Set("X-Admin", "1")
+		return nil
+	})
+	g.Mount("/api/", inner)
+	g.Mount("/mux", mux)
+	g.GET("/mux/own", func(ctx *Context) Response { return PlainResponse("", "own") })
+
+	outer := New(SetErrLogger(nil), SetTrustedProxies("10.0.0.1"))
+	outer.Mount("/outer", srv)
+
+	for _, tc := range []struct {
+		method, path, exp string
+		from, prefix      string
+	}{
+		{"GET", "/admin/api/users/1", `{"data":"/admin/api /users/1 1","code":200,"success":true}`, "", ""},
+		{"POST", "/admin/mux", "POST /admin/mux /", "", ""},
+		{"DELETE", "/admin/mux/a/b?x=1", "DELETE /admin/mux /a/b", "", ""},
+		{"PROPFIND", "/admin/mux/dav", "PROPFIND /admin/mux /dav", "", ""},
+		{"MKCOL", "/admin/mux/dav/x", "MKCOL /admin/mux /dav/x", "", ""},
+		{"TRACE", "/admin/mux", "TRACE /admin/mux /", "", ""},
+		{"GET", "/admin/mux/own", "own", "", ""},
+		{"GET", "/admin/mux/x", "GET /admin/mux /x", "", "/spoofed"},
+		{"GET", "/outer/admin/mux/x", "GET /outer/admin/mux /x", "", "/spoofed"},
+		{"GET", "/outer/admin/mux/x", "GET /proxy/outer/admin/mux /x", "10.0.0.1:1234", "/proxy"},
+		{"GET", "/outer/admin/api/users/2", `{"data":"/outer/admin/api /users/2 2","code":200,"success":true}`, "", ""},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.from != "" {
+			req.RemoteAddr = tc.from
+		}
+		if tc.prefix != "" {
+			req.Header.Set("X-Forwarded-Prefix", tc.prefix)
+		}
+		rr := httptest.NewRecorder()
+		h := http.Handler(srv)
+		if strings.HasPrefix(tc.path, "/outer") {
+			h = outer
+		}
+		h.ServeHTTP(rr, req)
+		if got := strings.TrimSpace(rr.Body.String()); got != tc.exp || rr.Header().Get("X-Admin") != "1" {
+			t.Errorf("%s %s: expected %q, got %q (%v)", tc.method, tc.path, tc.exp, got, rr.Header())
+		}
+	}
+}
+
+func requireAuth(ctx *Context) Response {
+	if v, _ := ctx.Route().MetaValue("public"); v == true {
+		return nil
+	}
+	if ctx.ReqHeader("Authorization") == "" {
+		return RespForbidden
+	}
+	return nil
+}
+
+func TestRoutesInfo(t *testing.T) {
+	srv := New(SetErrLogger(nil))
+	srv.GET("/", func(ctx *Context) Response { return NewJSONResponse("root") })
+
+	api := srv.SubGroup("api", "/api", requireAuth)
+	api.GET("/health", func(ctx *Context) Response { return NewJSONResponse("ok") }).Meta("public", true)
+	api.GET("/users/:id", func(ctx *Context) Response { return NewJSONResponse(ctx.Param("id")) }).Name("user").Meta("auth", "admin")
+
+	for path, code := range map[string]int{
+		"/api/health":  http.StatusOK,
+		"/api/users/1": http.StatusForbidden,
+	} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != code {
+			t.Errorf("%s: expected %d, got %d", path, code, rr.Code)
+		}
+	}
+
+	if n := len(srv.Routes()); n != 3 {
+		t.Fatalf("expected 3 routes, got %d", n)
+	}
+
+	ris := api.RoutesInfo()
+	if len(ris) != 2 {
+		t.Fatalf("expected 2 routes, got %+v", ris)
+	}
+
+	ri := ris[1]
+	if ri.Method != "GET" || ri.Path != "/api/users/:id" || ri.Group != "api" || ri.Name != "user" || ri.Meta["auth"] != "admin" {
+		t.Fatalf("unexpected route info: %+v", ri)
+	}
+
+	if len(ri.Middleware) != 1 || !strings.HasSuffix(ri.Middleware[0], ".requireAuth") || len(ri.Handlers) != 1 {
+		t.Fatalf("unexpected chain: %v %v", ri.Middleware, ri.Handlers)
+	}
+}
+
+func TestOnReqInfo(t *testing.T) {
+	var got []*router.RequestInfo
+	srv := New(SetErrLogger(nil), SetCatchPanics(true), SetOnReqInfo(func(_ context.Context, ri *router.RequestInfo) {
+		got = append(got, ri) // retaining it is safe
+	}))
+	srv.PanicHandler = func(ctx *Context, v any, fr *oerrs.Frame) { ctx.WriteHeader(http.StatusInternalServerError) }
+
+	g := srv.SubGroup("users", "/users")
+	g.POST("/:id", func(ctx *Context) Response {
+		var m map[string]any
+		if err := ctx.BindJSON(&m); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		ctx.WriteHeader(http.StatusCreated)
+		ctx.WriteString("created")
+		return nil
+	})
+	g.GET("/panic", func(ctx *Context) Response { panic("boom") })
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader(`{"a":1}`)))
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/panic", nil))
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 calls, got %+v", got)
+	}
+
+	if ri := got[0]; ri.Group != "users" || ri.Method != "POST" || ri.Route != "/users/:id" || ri.Path != "/users/1" ||
+		ri.Status != http.StatusCreated || ri.BytesWritten != 7 || ri.BytesRead != 7 || ri.Panicked {
+		t.Fatalf("unexpected info: %+v", ri)
+	}
+
+	if ri := got[1]; ri.Route != "/users/panic" || ri.Status != http.StatusInternalServerError || !ri.Panicked {
+		t.Fatalf("unexpected info: %+v", ri)
+	}
+}
+
+type spanRecorder struct {
+	mux   sync.Mutex
+	spans []*trace.Span
+}
+
+func (r *spanRecorder) Export(_ context.Context, spans []*trace.Span) error {
+	r.mux.Lock()
+	r.spans = append(r.spans, spans...)
+	r.mux.Unlock()
+	return nil
+}
+
+func TestTrace(t *testing.T) {
+	var upstreamTP string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		upstreamTP = req.Header.Get("Traceparent")
+		io.WriteString(w, `{"success":true,"code":200,"data":"ok"}`)
+	}))
+	defer upstream.Close()
+
+	var rec spanRecorder
+	tr := trace.NewTracer("test", &rec)
+
+	srv := New(SetErrLogger(nil), SetCatchPanics(true))
+	srv.PanicHandler = func(ctx *Context, v any, fr *oerrs.Frame) { ctx.WriteHeader(http.StatusInternalServerError) }
+	srv.Use(Trace(tr))
+	srv.GET("/proxy/*path", ProxyHandler(upstream.URL, nil))
+	srv.GET("/json", func(ctx *Context) Response {
+		var s string
+		if err := JSONRequestCtx(ctx.Req.Context(), http.MethodGet, upstream.URL, nil, &s); err != nil {
+			return NewJSONErrorResponse(http.StatusBadGateway, err)
+		}
+		return NewJSONResponse(s)
+	})
+	srv.GET("/panic/:id", func(ctx *Context) Response { panic("boom") })
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	for _, p := range []string{"/proxy/x", "/json", "/panic/1"} {
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		req.Header.Set("Traceparent", parent)
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+
+		if p != "/panic/1" {
+			sc, ok := trace.ParseTraceparent(upstreamTP)
+			if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() == "00f067aa0ba902b7" {
+				t.Errorf("%s: unexpected upstream traceparent: %q", p, upstreamTP)
+			}
+			upstreamTP = ""
+		}
+	}
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(rec.spans))
+	}
+
+	for i, name := range []string{"GET /proxy/*path", "GET /json", "GET /panic/:id"} {
+		if s := rec.spans[i]; s.Name != name || s.Kind != trace.SpanKindServer || s.Parent.String() != "00f067aa0ba902b7" {
+			t.Errorf("unexpected span: %+v", s)
+		}
+	}
+
+	if s := rec.spans[2]; s.Status != trace.StatusError || len(s.Events) != 1 || s.Events[0].Name != "exception" {
+		t.Fatalf("unexpected panic span: %+v", s)
+	}
+}
+
+func TestSLogger(t *testing.T) {
+	var buf bytes.Buffer
+	srv := New(SetSLogger(slog.New(slog.NewJSONHandler(&buf, nil))), SetCatchPanics(true))
+	srv.Use(RequestID(), LogRequests(true))
+	srv.POST("/users/:id", func(ctx *Context) Response {
+		ctx.Logger().Info("handler")
+		return NewJSONResponse("ok")
+	})
+	srv.GET("/panic", func(ctx *Context) Response { panic("boom") })
+
+	req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader(`{"a":1}`))
+	req.Header.Set("User-Agent", "test")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	var lines []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var m map[string]any
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, m)
+	}
+
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %v", lines)
+	}
+
+	if m := lines[0]; m["msg"] != "handler" || m["route"] != "/users/:id" || m["method"] != "POST" || m["requestID"] == nil || m["clientIP"] != "192.0.2.1" {
+		t.Fatalf("unexpected handler log: %v", m)
+	}
+
+	if m := lines[1]; m["msg"] != "request" || m["status"] != 200.0 || m["userAgent"] != "test" || m["bytes"] == 0.0 ||
+		m["request"] != `{"a":1}` || m["duration"] == nil || m["requestID"] != lines[0]["requestID"] {
+		t.Fatalf("unexpected request log: %v", m)
+	}
+
+	if m := lines[2]; m["msg"] != "panic" || m["level"] != "ERROR" || m["panic"] != "boom" || m["function"] == nil || m["line"] == nil {
+		t.Fatalf("unexpected panic log: %v", m)
+	}
+
+	if m := lines[3]; m["msg"] != "request" || m["status"] != 500.0 || m["route"] != "/panic" {
+		t.Fatalf("unexpected request log: %v", m)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var upstreamID string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		upstreamID = req.Header.Get(RequestIDHeader)
+	}))
+	defer upstream.Close()
+
+	srv := New(SetErrLogger(nil))
+	srv.Use(RequestID())
+	srv.GET("/proxy/*path", ProxyHandler(upstream.URL, nil))
+	srv.GET("/err", func(ctx *Context) Response { return NewJSONErrorResponse(http.StatusTeapot, "nope") })
+
+	id := NewRequestID()
+	if len(id) != 36 || id[14] != '7' || !strings.Contains("89ab", id[19:20]) {
+		t.Fatalf("invalid uuid v7: %s", id)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy/x", nil)
+	req.Header.Set(RequestIDHeader, "client-id")
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if h := rr.Header().Get(RequestIDHeader); h != "client-id" || upstreamID != "client-id" {
+		t.Fatalf("expected the client's id, got %q / %q", h, upstreamID)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/err", nil)
+	req.Header.Set(RequestIDHeader, "bad\nid")
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	id = rr.Header().Get(RequestIDHeader)
+	if len(id) != 36 {
+		t.Fatalf("expected a generated id, got %q", id)
+	}
+
+	var resp JSONResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.RequestID != id || len(resp.Errors) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// LogRequests' counter isn't a request id
+	var logBuf bytes.Buffer
+	srv = New(SetErrLogger(log.New(&logBuf, "", 0)))
+	srv.Use(LogRequests(false))
+	srv.GET("/err", func(ctx *Context) Response {
+		if ctx.RequestID() != "" {
+			t.Errorf("unexpected request id: %q", ctx.RequestID())
+		}
+		return NewJSONErrorResponse(http.StatusTeapot, "nope")
+	})
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/err", nil))
+	if strings.Contains(rr.Body.String(), "requestID") || rr.Header().Get(RequestIDHeader) != "" || !strings.Contains(logBuf.String(), "[reqID:0") {
+		t.Fatalf("unexpected response: %s %v / %s", rr.Body.String(), rr.Header(), logBuf.String())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	serve := func(opts *AccessLogOptions, req *http.Request) string {
+		buf.Reset()
+		srv := New(SetErrLogger(nil))
+		srv.Use(AccessLog(&buf, opts))
+		srv.POST("/users/:id", func(ctx *Context) Response {
+			var m map[string]any
+			if err := ctx.BindJSON(&m); err != nil {
+				return NewJSONErrorResponse(http.StatusBadRequest, err)
+			}
+			ctx.Header().Set("Set-Cookie", "sid=SECRET")
+			return NewJSONResponse(m["user"])
+		})
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+		return buf.String()
+	}
+
+	newReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/users/1?x=1", strings.NewReader(`{"user":"u","password":"p","nested":{"token":[1,2]},"n":1}`))
+		req.Header.Set("Content-Type", MimeJSON)
+		req.Header.Set("User-Agent", "test")
+		req.Header.Set("Authorization", "Bearer secret")
+		req.SetBasicAuth("bob", "x")
+		return req
+	}
+
+	line := serve(&AccessLogOptions{Format: AccessLogCombined}, newReq())
+	if !strings.HasPrefix(line, `192.0.2.1 - bob [`) || !strings.HasSuffix(line, `] "POST /users/1?x=1 HTTP/1.1" 200 39 "-" "test"`+"\n") {
+		t.Fatalf("unexpected combined line: %q", line)
+	}
+
+	line = serve(&AccessLogOptions{Format: `%m %{route}x %{Authorization}i %{Content-Type}o %{body}x %%`, MaxBodySize: 1024}, newReq())
+	if exp := `POST /users/:id [REDACTED] application/json {\"user\":\"u\",\"password\":\"[REDACTED]\",\"nested\":{\"token\":\"[REDACTED]\"},\"n\":1} %` + "\n"; line != exp {
+		t.Fatalf("unexpected template line:\n%q\n%q", line, exp)
+	}
+
+	line = serve(&AccessLogOptions{Format: AccessLogJSON, MaxBodySize: 30, Headers: []string{"authorization"}}, newReq())
+	var m map[string]any
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["status"] != 200.0 || m["route"] != "/users/:id" || m["user"] != "bob" || m["Authorization"] != "[REDACTED]" ||
+		m["body"] != `{"user":"u","password":"[REDACTED]"...` {
+		t.Fatalf("unexpected json line: %v", m)
+	}
+
+	line = serve(&AccessLogOptions{Format: AccessLogLogfmt}, newReq())
+	if !strings.Contains(line, ` method=POST path=/users/1 query="x=1" proto=HTTP/1.1 route=/users/:id status=200 bytes=39 `) {
+		t.Fatalf("unexpected logfmt line: %q", line)
+	}
+
+	secretReq := func() *http.Request {
+		req := newReq()
+		req.URL.RawQuery = "x=1&access_token=SECRET"
+		return req
+	}
+	line = serve(&AccessLogOptions{Format: `"%r" %q %{Set-Cookie}o`}, secretReq())
+	if exp := `"POST /users/1?x=1&access_token=%5BREDACTED%5D HTTP/1.1" ?x=1&access_token=%5BREDACTED%5D [REDACTED]` + "\n"; line != exp {
+		t.Fatalf("unexpected redacted line:\n%q\n%q", line, exp)
+	}
+	for _, f := range []string{AccessLogJSON, AccessLogLogfmt, AccessLogCombined} {
+		if line = serve(&AccessLogOptions{Format: f}, secretReq()); strings.Contains(line, "SECRET") {
+			t.Fatalf("%s: query not redacted: %q", f, line)
+		}
+	}
+
+	for _, ct := range []string{"application/merge-patch+json", "application/vnd.api+json; charset=utf-8"} {
+		req := newReq()
+		req.Header.Set("Content-Type", ct)
+		line = serve(&AccessLogOptions{Format: `%{body}x`, MaxBodySize: 1024}, req)
+		if strings.Contains(line, `"p"`) || !strings.Contains(line, `[REDACTED]`) {
+			t.Fatalf("%s: body not redacted: %q", ct, line)
+		}
+	}
+
+	var mp bytes.Buffer
+	mw := multipart.NewWriter(&mp)
+	mw.WriteField("user", "u")
+	mw.WriteField("password", "SECRET")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/users/1", &mp)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if line = serve(&AccessLogOptions{Format: `%{body}x`, MaxBodySize: 1024}, req); line != "-\n" {
+		t.Fatalf("multipart body logged: %q", line)
+	}
+
+	req = newReq()
+	req.URL.Path = "/users/1\nevil - - \"GET x\" 200 0"
+	req.Header.Set("Content-Type", MimePlain)
+	req.Body = io.NopCloser(strings.NewReader("a\n\x1b\\"))
+	line = serve(&AccessLogOptions{Format: `%U %{body}x`, MaxBodySize: 1024}, req)
+	if exp := `/users/1\nevil - - \"GET x\" 200 0 a\n\x1b\\` + "\n"; line != exp {
+		t.Fatalf("unescaped line:\n%q\n%q", line, exp)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	AccessLog(&buf, &AccessLogOptions{Format: "%z"})
+}
+
+func TestAsyncWriter(t *testing.T) {
+	fn := t.TempDir() + "/access.log"
+	lf, err := OpenLogFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw := NewAsyncWriter(lf, 2)
+	for i := 0; i < 10; i++ {
+		aw.Write([]byte("line\n"))
+	}
+	if err := os.Rename(fn, fn+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	aw.Write([]byte("after\n"))
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	old, _ := os.ReadFile(fn + ".1")
+	cur, _ := os.ReadFile(fn)
+	if string(old)+string(cur) != strings.Repeat("line\n", 10)+"after\n" {
+		t.Fatalf("unexpected files: %q %q", old, cur)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	type info struct{ IP, Scheme, Host string }
+	get := func(srv *Server, remote string, hdrs ...string) (out info) {
+		srv.GET("/", func(ctx *Context) Response {
+			out = info{ctx.ClientIP(), ctx.Scheme(), ctx.Host()}
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		for i := 0; i < len(hdrs); i += 2 {
+			req.Header.Add(hdrs[i], hdrs[i+1])
+		}
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+		return
+	}
+
+	spoofed := []string{
+		"X-Real-Ip", "1.1.1.1",
+		"X-Forwarded-For", "1.1.1.1, 2.2.2.2",
+		"X-Forwarded-Proto", "https",
+		"X-Forwarded-Host", "evil.com",
+	}
+
+	if got := get(New(SetErrLogger(nil)), "8.8.8.8:1234", spoofed...); got != (info{"8.8.8.8", "http", "example.com"}) {
+		t.Fatalf("untrusted peer: %+v", got)
+	}
+
+	newSrv := func() *Server { return New(SetErrLogger(nil), SetTrustedProxies("10.0.0.0/8", "::1")) }
+
+	if got := get(newSrv(), "8.8.8.8:1234", spoofed...); got != (info{"8.8.8.8", "http", "example.com"}) {
+		t.Fatalf("untrusted peer: %+v", got)
+	}
+
+	if got := get(newSrv(), "10.0.0.1:1234", "X-Forwarded-For", "1.1.1.1, 2.2.2.2, 10.1.1.1",
+		"X-Forwarded-Proto", "https", "X-Forwarded-Host", "api.example.com"); got != (info{"2.2.2.2", "https", "api.example.com"}) {
+		t.Fatalf("xff: %+v", got)
+	}
+
+	if got := get(newSrv(), "[::1]:1234", "X-Forwarded-For", "10.2.2.2", "X-Forwarded-For", "10.1.1.1"); got.IP != "10.2.2.2" {
+		t.Fatalf("all trusted: %+v", got)
+	}
+
+	if got := get(newSrv(), "10.0.0.1:1234", "X-Real-Ip", "3.3.3.3", "Forwarded", "for=4.4.4.4;proto=https"); got != (info{"10.0.0.1", "http", "example.com"}) {
+		t.Fatalf("unconfigured headers: %+v", got)
+	}
+
+	withHeader := func(h string) *Server {
+		return New(SetErrLogger(nil), SetTrustedProxies("10.0.0.0/8", "::1"), SetTrustedProxyHeader(h))
+	}
+
+	if got := get(withHeader("x-real-ip"), "10.0.0.1:1234", "X-Real-Ip", "3.3.3.3", "X-Forwarded-For", "9.9.9.9"); got.IP != "3.3.3.3" {
+		t.Fatalf("x-real-ip: %+v", got)
+	}
+
+	fwd := []string{
+		"Forwarded", `for=1.1.1.1;proto=http, for="[2001:db8::1]:4711";proto=https;host="a.example.com"`,
+		"Forwarded", `for=10.0.0.2:80`,
+		"X-Forwarded-For", "9.9.9.9",
+		"X-Forwarded-Proto", "http",
+		"X-Forwarded-Host", "evil.com",
+	}
+	if got := get(withHeader(ProxyHeaderForwarded), "10.0.0.1:1234", fwd...); got != (info{"2001:db8::1", "https", "a.example.com"}) {
+		t.Fatalf("forwarded: %+v", got)
+	}
+	if got := get(withHeader(ProxyHeaderXForwardedFor), "10.0.0.1:1234", fwd...); got != (info{"9.9.9.9", "http", "evil.com"}) {
+		t.Fatalf("xff with forwarded: %+v", got)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+		SetTrustedProxyHeader("X-Client-Ip")
+	}()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	SetTrustedProxies("nope")
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var (
+		started = make(chan struct{}, 10)
+		unblock = make(chan struct{})
+	)
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/slow", ConcurrencyLimit(ConcurrencyOptions{Limit: 2, QueueSize: 1, QueueTimeout: time.Minute}), func(ctx *Context) Response {
+		started <- struct{}{}
+		<-unblock
+		return NewJSONResponse("ok")
+	})
+
+	var (
+		wg    sync.WaitGroup
+		codes = make(chan int, 10)
+	)
+	get := func() {
+		defer wg.Done()
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		codes <- rr.Code
+	}
+
+	wg.Add(2)
+	go get()
+	go get()
+	<-started
+	<-started
+
+	wg.Add(1)
+	go get() // queued
+	time.Sleep(50 * time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected a 503, got %d %v", rr.Code, rr.Header())
+	}
+
+	close(unblock)
+	wg.Wait()
+	close(codes)
+	for c := range codes {
+		if c != http.StatusOK {
+			t.Fatalf("expected 200, got %d", c)
+		}
+	}
+	if len(started) != 1 {
+		t.Fatalf("expected the queued request to run, got %d", len(started))
+	}
+}
+
+func TestConcurrencyLimitAdaptive(t *testing.T) {
+	opts := ConcurrencyOptions{Limit: 10, LatencyTarget: time.Millisecond, MinLimit: 2}
+	cl := &concurrencyLimiter{opts: opts, limit: 10}
+	for i := 0; i < 20; i++ {
+		cl.inFlight++
+		cl.release(time.Second, http.StatusOK)
+	}
+	if cl.limit != 2 {
+		t.Fatalf("expected the limit to drop to 2, got %v", cl.limit)
+	}
+
+	for i := 0; i < 100; i++ {
+		cl.inFlight++
+		cl.release(0, http.StatusOK)
+	}
+	if cl.limit <= 2 || cl.limit > 10 {
+		t.Fatalf("expected the limit to grow, got %v", cl.limit)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var (
+		lateErr  = make(chan error, 1)
+		logged   []int
+		logMux   sync.Mutex
+		deadline = make(chan bool, 1)
+	)
+
+	srv := New(SetErrLogger(nil), SetCatchPanics(true))
+	srv.Use(func(ctx *Context) Response {
+		ctx.NextMiddleware()
+		ctx.Next()
+		logMux.Lock()
+		logged = append(logged, ctx.Status())
+		logMux.Unlock()
+		return nil
+	})
+
+	g := srv.SubGroup("api", "/api", Timeout(50*time.Millisecond))
+	g.GET("/fast", func(ctx *Context) Response {
+		_, ok := ctx.Deadline()
+		deadline <- ok
+		ctx.Header().Set("X-Fast", "1")
+		ctx.Set("k", "v")
+		return NewJSONResponse("fast")
+	})
+	g.GET("/slow", func(ctx *Context) Response {
+		<-ctx.Req.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := ctx.Write([]byte("late"))
+		lateErr <- err
+		return nil
+	})
+	JSONGet(g, "/db", func(ctx *Context) (string, error) {
+		<-ctx.Req.Context().Done()
+		return "", ctx.Req.Context().Err()
+	}, true)
+	g.GET("/longer", Timeout(time.Second), func(ctx *Context) Response {
+		dl, _ := ctx.Deadline()
+		return NewJSONResponse(time.Until(dl) < 100*time.Millisecond)
+	})
+	g.GET("/panic", func(ctx *Context) Response { panic("boom") })
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/fast", nil))
+	if rr.Code != 200 || rr.Header().Get("X-Fast") != "1" || !strings.Contains(rr.Body.String(), "fast") || !<-deadline {
+		t.Fatalf("unexpected response: %d %v %s", rr.Code, rr.Header(), rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/slow", nil))
+	if rr.Code != http.StatusServiceUnavailable || strings.Contains(rr.Body.String(), "late") {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Body)
+	}
+	if err := <-lateErr; err != http.ErrHandlerTimeout {
+		t.Fatalf("expected ErrHandlerTimeout, got %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/db", nil))
+	if rr.Code != http.StatusGatewayTimeout && rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/longer", nil))
+	if rr.Code != 200 || !strings.Contains(rr.Body.String(), "true") {
+		t.Fatalf("expected the group deadline, got: %d %s", rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/panic", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Body)
+	}
+
+	logMux.Lock()
+	defer logMux.Unlock()
+	if len(logged) != 5 || logged[0] != 200 || logged[1] != http.StatusServiceUnavailable || logged[4] != 500 {
+		t.Fatalf("unexpected statuses: %v", logged)
+	}
+}
+
+func TestTimeoutLateReads(t *testing.T) {
+	type late struct {
+		id   string
+		body string
+		err  error
+	}
+	var (
+		proceed = make(chan struct{})
+		out     = make(chan late, 1)
+	)
+
+	srv := New(SetErrLogger(nil))
+	g := srv.SubGroup("api", "/api", Timeout(20*time.Millisecond))
+	g.POST("/late/:id", func(ctx *Context) Response {
+		<-proceed
+		b, err := io.ReadAll(ctx.Req.Body)
+		out <- late{ctx.Param("id"), string(b), err}
+		return nil
+	})
+	srv.GET("/other/:id", func(ctx *Context) Response { return NewJSONResponse(ctx.Param("id")) })
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/late/1", strings.NewReader("body")))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Body)
+	}
+
+	// reuse the pooled params while the late handler is still running
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other/2", nil))
+		}()
+	}
+	close(proceed)
+	wg.Wait()
+
+	if l := <-out; l.id != "1" || l.body != "" || l.err != http.ErrHandlerTimeout {
+		t.Fatalf("unexpected late reads: %+v", l)
+	}
+}
+
+type bindLevel int
+
+func (l *bindLevel) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+type bindPage struct {
+	Limit int `query:"limit"`
+}
+
+type bindReq struct {
+	bindPage
+	ID     int64         `path:"id"`
+	Tags   []string      `query:"tag"`
+	Since  time.Time     `query:"since"`
+	Wait   time.Duration `query:"wait"`
+	Ptr    *bool         `query:"ptr"`
+	Level  bindLevel     `query:"level"`
+	Tenant string        `header:"X-Tenant"`
+	SID    string        `cookie:"sid"`
+	Name   string        `form:"name"`
+	Body   string        `json:"body"`
+}
+
+func TestBindRequest(t *testing.T) {
+	var got bindReq
+	srv := New(SetErrLogger(nil))
+	srv.POST("/items/:id", func(ctx *Context) Response {
+		got = bindReq{}
+		if err := ctx.BindRequest(&got); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return RespOK
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/items/42?limit=10&tag=a&tag=b&since=2024-01-02&wait=1s&ptr=true&level=high", strings.NewReader("name=bob"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Tenant", "acme")
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != 200 || got.ID != 42 || got.Limit != 10 || len(got.Tags) != 2 || got.Tags[1] != "b" || got.Since.Day() != 2 ||
+		got.Wait != time.Second || got.Ptr == nil || !*got.Ptr || got.Level != 2 || got.Tenant != "acme" || got.SID != "s1" || got.Name != "bob" {
+		t.Fatalf("unexpected result: %d %s %+v", rr.Code, rr.Body, got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/items/1", strings.NewReader(`{"body":"b"}`))
+	req.Header.Set("Content-Type", MimeJSON)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	if got.Body != "b" || got.ID != 1 {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+
+	srv.GET("/items/:id", func(ctx *Context) Response {
+		got = bindReq{}
+		if err := ctx.BindRequest(&got); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return RespOK
+	})
+	for _, c := range []Codec{JSONCodec{}, MsgpCodec{}, CBORCodec{}} { // a bodiless request with a content-type
+		req = httptest.NewRequest(http.MethodGet, "/items/3?limit=5", nil)
+		req.Header.Set("Content-Type", c.ContentType())
+		rr = httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		if rr.Code != 200 || got.ID != 3 || got.Limit != 5 {
+			t.Fatalf("%s: unexpected result: %d %s %+v", c.ContentType(), rr.Code, rr.Body, got)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/items/x?limit=y&level=mid&since=now", nil))
+	var resp JSONResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusBadRequest || len(resp.Errors) != 4 {
+		t.Fatalf("unexpected response: %d %+v", rr.Code, resp)
+	}
+	for i, f := range []string{"limit", "id", "since", "level"} {
+		if e := resp.Errors[i]; e.Field != f || e.Code != http.StatusBadRequest {
+			t.Fatalf("unexpected error: %+v", e)
+		}
+	}
+}
+
+type valItem struct {
+	SKU string `json:"sku" validate:"required,len=4"`
+	Qty int    `json:"qty" validate:"min=1,max=10"`
+}
+
+type valOrder struct {
+	Email string             `json:"email" validate:"required,email"`
+	Site  string             `json:"site" validate:"omitempty,url"`
+	Kind  string             `json:"kind" validate:"oneof=a b"`
+	Items []valItem          `json:"items" validate:"required,max=2"`
+	Meta  map[string]valItem `json:"meta"`
+	Note  *string            `json:"note" validate:"max=5"`
+}
+
+func (o *valOrder) Validate() error {
+	if o.Kind == "b" && len(o.Items) > 1 {
+		return Error{Field: "items", Message: "kind b only allows one item"}
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	note := "too long"
+	err := Validate(&valOrder{
+		Email: "nope",
+		Site:  "/relative",
+		Kind:  "c",
+		Items: []valItem{{SKU: "abcd", Qty: 1}, {SKU: "abc", Qty: 11}, {}},
+		Meta:  map[string]valItem{"x": {SKU: "abcd"}},
+		Note:  &note,
+	})
+
+	me, ok := err.(MultiError)
+	if !ok {
+		t.Fatalf("expected a MultiError, got %T: %v", err, err)
+	}
+
+	var fields []string
+	for _, err := range me {
+		fields = append(fields, err.(Error).Field)
+	}
+	exp := "email site kind items items[1].sku items[1].qty items[2].sku items[2].qty meta[x].qty note"
+	if got := strings.Join(fields, " "); got != exp {
+		t.Fatalf("unexpected fields:\n%s\n%s\n%v", got, exp, me)
+	}
+
+	if err := Validate(&valOrder{Email: "a@b.co", Kind: "b", Items: []valItem{{"abcd", 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Validate(&valOrder{Email: "a@b.co", Kind: "b", Items: []valItem{{"abcd", 1}, {"abcd", 2}}})
+	if me, ok := err.(MultiError); !ok || len(me) != 1 || me[0].(Error).Field != "items" || me[0].(Error).Code != 400 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.POST("/bind", func(ctx *Context) Response {
+		var o valOrder
+		if err := ctx.BindJSON(&o); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		return RespOK
+	})
+	JSONPost(srv, "/gen", func(ctx *Context, o valOrder) (string, error) { return "ok", nil }, true)
+
+	for _, p := range []string{"/bind", "/gen"} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, p, strings.NewReader(`{"kind":"a","items":[{"sku":"abcd","qty":0}]}`)))
+		var resp JSONResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Code != 400 || len(resp.Errors) != 2 || resp.Errors[0].Field != "email" || resp.Errors[1].Field != "items[0].qty" {
+			t.Fatalf("%s: unexpected response: %d %+v", p, rr.Code, resp)
+		}
+	}
+
+	JSONPost(srv, "/raw", func(ctx *Context, o valOrder) (string, error) { return "ok", nil }, false)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/raw", strings.NewReader(`{"kind":"a","items":[{"sku":"abcd","qty":0}]}`)))
+	var errs []Error
+	if err := json.NewDecoder(rr.Body).Decode(&errs); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != 400 || len(errs) != 2 || errs[0].Field != "email" || errs[1].Field != "items[0].qty" {
+		t.Fatalf("unexpected raw response: %d %+v", rr.Code, errs)
+	}
+
+	if err := Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	type foreign struct { // go-playground/validator tags
+		ID   string    `json:"id" validate:"required,uuid"`
+		N    int       `json:"n" validate:"gte=1"`
+		Tags []string  `json:"tags" validate:"dive,required"`
+		At   time.Time `json:"at" validate:"max=5,email"`
+		Any  any       `json:"any" validate:"min=1"`
+	}
+	err = Validate(&foreign{Tags: []string{""}, Any: struct{}{}})
+	if me, ok := err.(MultiError); !ok || len(me) != 1 || me[0].(Error).Field != "id" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	var types []string
+	for _, mr := range ParseAccept("text/*;q=0.5, application/json;q=0.9, */*;q=0.1, application/msgpack, text/html;level=1;q=0.5, bad") {
+		types = append(types, mr.Type+":"+strconv.FormatFloat(mr.Q, 'f', -1, 64))
+	}
+	if got, exp := strings.Join(types, " "), "application/msgpack:1 application/json:0.9 text/html:0.5 text/*:0.5 */*:0.1"; got != exp {
+		t.Fatalf("unexpected order:\n%s\n%s", got, exp)
+	}
+
+	for accept, exp := range map[string]string{
+		"":                    MimeJSON,
+		"*/*":                 MimeJSON,
+		"application/*":       MimeJSON,
+		"application/msgpack": MimeMsgPack,
+		"application/json;q=0.5, application/msgpack": MimeMsgPack,
+		"application/*;q=0.5, application/json;q=0":   MimeMsgPack,
+		"text/html": "",
+	} {
+		c, ok := NegotiateCodec(accept, DefaultCodec)
+		if exp == "" {
+			if ok {
+				t.Fatalf("%q: expected no match, got %T", accept, c)
+			}
+			continue
+		}
+		if !ok || c.ContentType() != exp {
+			t.Fatalf("%q: expected %s, got %v", accept, exp, c)
+		}
+	}
+
+	srv := New(SetErrLogger(nil))
+	srv.GET("/negotiate", func(ctx *Context) Response {
+		ctx.Negotiate(http.StatusOK, M{"a": 1})
+		return nil
+	})
+	srv.GET("/encode", func(ctx *Context) Response {
+		ctx.Encode(http.StatusOK, M{"a": 1})
+		return nil
+	})
+	srv.GET("/resp", func(ctx *Context) Response { return NewNegotiatedResponse("x") })
+	Get[Negotiated](srv, "/gen", func(ctx *Context) (M, error) { return M{"a": 1}, nil }, false)
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, p := range []string{"/negotiate", "/encode", "/resp", "/gen"} {
+		rr := get(p, "application/msgpack, application/json;q=0.8")
+		if rr.Code != 200 || rr.Header().Get("Content-Type") != MimeMsgPack || rr.Header().Get("Vary") != "Accept" {
+			t.Fatalf("%s: unexpected response: %d %v", p, rr.Code, rr.Header())
+		}
+
+		if rr = get(p, ""); rr.Code != 200 || rr.Header().Get("Content-Type") != MimeJSON {
+			t.Fatalf("%s: unexpected response: %d %v", p, rr.Code, rr.Header())
+		}
+
+		rr = get(p, "text/html")
+		if p == "/encode" {
+			if rr.Code != 200 || rr.Header().Get("Content-Type") != MimeJSON {
+				t.Fatalf("%s: expected a json fallback: %d %v", p, rr.Code, rr.Header())
+			}
+			continue
+		}
+		if rr.Code != http.StatusNotAcceptable {
+			t.Fatalf("%s: expected a 406, got %d %v", p, rr.Code, rr.Header())
+		}
+	}
+
+	srv.POST("/encode", func(ctx *Context) Response {
+		ctx.Encode(http.StatusOK, M{"a": 1})
+		return nil
+	})
+	for accept, exp := range map[string]string{
+		"":    MimeMsgPack,
+		"*/*": MimeMsgPack,
+		"text/html, application/*;q=0.9, */*;q=0.8":         MimeMsgPack,
+		"application/json":                                  MimeJSON,
+		"application/json, application/msgpack":             MimeMsgPack,
+		"application/json;q=0.5, application/msgpack;q=0.9": MimeMsgPack,
+		"application/json, application/msgpack;q=0.9":       MimeJSON,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/encode", nil)
+		req.Header.Set("Content-Type", MimeMsgPack)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		if rr.Code != 200 || rr.Header().Get("Content-Type") != exp {
+			t.Fatalf("msgpack request, %q: expected %s, got %d %v", accept, exp, rr.Code, rr.Header())
+		}
+	}
+}
+
+func FuzzCBORDecode(f *testing.F) {
+	for _, hexIn := range []string{
+		"00", "17", "1bffffffffffffffff", "3903e7", "f93c00", "fb3ff199999999999a", "4401020304", "6449455446",
+		"f5", "f6", "8301820203820405", "9f018202039f0405ffff", "bf61610161629f0203ffff", "a201020304",
+		"7f657374726561646d696e67ff", "c11a514b67b0", "a1614e190100", "a1f601", "a1800102",
+	} {
+		b, _ := hex.DecodeString(hexIn)
+		f.Add(b)
+	}
+
+	type target struct {
+		N    int8           `cbor:"n"`
+		S    string         `cbor:"s"`
+		B    []byte         `cbor:"b"`
+		L    []any          `cbor:"l"`
+		M    map[string]int `cbor:"m"`
+		T    time.Time      `cbor:"t"`
+		Next *target        `cbor:"next"`
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var v any
+		(CBORCodec{}).Decode(bytes.NewReader(b), &v)
+		var m map[any]any
+		(CBORCodec{}).Decode(bytes.NewReader(b), &m)
+		var st target
+		(CBORCodec{}).Decode(bytes.NewReader(b), &st)
+	})
+}
+
+type testCodec struct{}
+
+func (testCodec) ContentType() string               { return "application/x-gserv-test" }
+func (testCodec) Decode(r io.Reader, out any) error { return PlainTextCodec{}.Decode(r, out) }
+func (testCodec) Encode(w io.Writer, v any) error   { _, err := fmt.Fprintf(w, "test:%v", v); return err }
+
+func TestCodecs(t *testing.T) {
+	type Item struct {
+		SKU string `json:"sku" xml:"sku"`
+		Qty int    `json:"qty" xml:"qty"`
+	}
+	type Order struct {
+		ID      int64             `json:"id" xml:"id" form:"id"`
+		Name    string            `json:"name" xml:"name"`
+		Price   float64           `json:"price" xml:"price"`
+		Paid    bool              `json:"paid" xml:"paid"`
+		When    time.Time         `json:"when" xml:"when"`
+		Tags    []string          `json:"tags" xml:"tags" form:"tag"`
+		Items   []Item            `json:"items,omitempty" xml:"items" form:"-"`
+		Meta    map[string]string `json:"meta,omitempty" xml:"-" form:"-"`
+		Blob    []byte            `json:"blob,omitempty" xml:"-" form:"-"`
+		Note    *string           `json:"note" xml:"note"`
+		Skipped string            `json:"-" xml:"-" form:"-"`
+	}
+
+	note := "fragile"
+	when := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	full := Order{
+		ID: 42, Name: "ünïcode", Price: 9.99, Paid: true, When: when, Tags: []string{"a", "b"},
+		Items: []Item{{"x", 1}, {"y", -2}}, Meta: map[string]string{"k": "v"}, Blob: []byte{0, 1, 2}, Note: &note,
+	}
+
+	t.Run("CBOR", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := (CBORCodec{}).Encode(&buf, full); err != nil {
+			t.Fatal(err)
+		}
+		var out Order
+		if err := (CBORCodec{}).Decode(&buf, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, full) {
+			t.Fatalf("round trip mismatch:\n%+v\n%+v", out, full)
+		}
+
+		// RFC 8949 appendix A
+		for hexIn, exp := range map[string]any{
+			"1903e8":                     int64(1000),
+			"3903e7":                     int64(-1000),
+			"1bffffffffffffffff":         uint64(math.MaxUint64),
+			"f93c00":                     1.0,
+			"f9c400":                     -4.0,
+			"fb3ff199999999999a":         1.1,
+			"6449455446":                 "IETF",
+			"4401020304":                 []byte{1, 2, 3, 4},
+			"f5":                         true,
+			"f6":                         nil,
+			"9f018202039f0405ffff":       []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}},
+			"bf61610161629f0203ffff":     map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}},
+			"a201020304":                 map[any]any{int64(1): int64(2), int64(3): int64(4)},
+			"7f657374726561646d696e67ff": "streaming",
+			"c074323031332d30332d32315432303a30343a30305a": time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC),
+			"c11a514b67b0": time.Unix(1363896240, 0),
+		} {
+			b, _ := hex.DecodeString(hexIn)
+			var v any
+			if err := (CBORCodec{}).Decode(bytes.NewReader(b), &v); err != nil {
+				t.Fatalf("%s: %v", hexIn, err)
+			}
+			if !reflect.DeepEqual(v, exp) {
+				t.Fatalf("%s: expected %#v, got %#v", hexIn, exp, v)
+			}
+		}
+
+		buf.Reset()
+		(CBORCodec{}).Encode(&buf, M{"b": []int{2, 3}, "a": 1, "c": 1.5, "d": -1})
+		if got, exp := hex.EncodeToString(buf.Bytes()), "a461610161628202036163fa3fc00000616420"; got != exp {
+			t.Fatalf("expected %s, got %s", exp, got)
+		}
+
+		for _, hexIn := range []string{"", "19", "5a00ffffff", "9b00000000ffffffff", "ff", "0102", "62c328", "a1f601", "a1800102"} {
+			b, _ := hex.DecodeString(hexIn)
+			var v any
+			if err := (CBORCodec{}).Decode(bytes.NewReader(b), &v); err == nil {
+				t.Fatalf("%q: expected an error, got %#v", hexIn, v)
+			}
+		}
+
+		for _, in := range []string{"\xa808080900800008008080\xf680000", "\xa1\x80\x01"} { // found by FuzzCBORDecode
+			var v any
+			if err := (CBORCodec{}).Decode(strings.NewReader(in), &v); err == nil {
+				t.Fatalf("%q: expected an error, got %#v", in, v)
+			}
+			var m map[any]any
+			if err := (CBORCodec{}).Decode(strings.NewReader(in), &m); err == nil {
+				t.Fatalf("%q: expected an error, got %#v", in, m)
+			}
+		}
+
+		var small struct{ N int8 }
+		if err := (CBORCodec{}).Decode(bytes.NewReader([]byte{0xa1, 0x61, 'N', 0x19, 0x01, 0x00}), &small); err == nil {
+			t.Fatal("expected an overflow error")
+		}
+	})
+
+	t.Run("Form", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := (FormCodec{}).Encode(&buf, full); err != nil {
+			t.Fatal(err)
+		}
+		if got, exp := buf.String(), "id=42&name=%C3%BCn%C3%AFcode&note=fragile&paid=true&price=9.99&tag=a&tag=b&when=2024-05-06T07%3A08%3A09.00000001Z"; got != exp {
+			t.Fatalf("expected %s, got %s", exp, got)
+		}
+
+		var out Order
+		if err := (FormCodec{}).Decode(&buf, &out); err != nil {
+			t.Fatal(err)
+		}
+		exp := full
+		exp.Items, exp.Meta, exp.Blob = nil, nil, nil
+		if !reflect.DeepEqual(out, exp) {
+			t.Fatalf("round trip mismatch:\n%+v\n%+v", out, exp)
+		}
+
+		err := (FormCodec{}).Decode(strings.NewReader("id=x&price=1&paid=maybe"), &out)
+		if me, ok := err.(MultiError); !ok || len(me) != 2 || me[0].(Error).Field != "id" || me[1].(Error).Field != "paid" {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+
+	RegisterCodec("application/x-gserv-test", testCodec{})
+
+	srv := New(SetErrLogger(nil), SetCatchPanics(true))
+	Post[Negotiated](srv, "/order", func(ctx *Context, o *Order) (*Order, error) {
+		if o.ID == 0 {
+			return nil, NewError(http.StatusBadRequest, "missing id")
+		}
+		return o, nil
+	}, false)
+	Post[XMLCodec](srv, "/xml", func(ctx *Context, o *Order) (*Order, error) { return o, nil }, false)
+	srv.POST("/bind", func(ctx *Context) Response {
+		var o Order
+		if err := ctx.Bind(&o); err != nil {
+			return NewJSONErrorResponse(http.StatusBadRequest, err)
+		}
+		ctx.Encode(http.StatusOK, Item{SKU: o.Name, Qty: int(o.ID)})
+		return nil
+	})
+
+	do := func(path, ct, accept string, c Codec, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if err := c.Encode(&buf, body); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, &buf)
+		req.Header.Set("Content-Type", ct)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	small := Order{ID: 7, Name: "x", When: when, Tags: []string{"t"}}
+	for _, tc := range []struct {
+		ct     string
+		accept string
+		enc    Codec
+		dec    Codec
+	}{
+		{MimeJSON, "", JSONCodec{}, JSONCodec{}},
+		{"application/merge-patch+json", MimeCBOR, JSONCodec{}, CBORCodec{}},
+		{"text/xml; charset=utf-8", MimeMsgPack, XMLCodec{}, MsgpCodec{}},
+		{MimeForm, "application/cbor;q=0.5, application/json", FormCodec{}, JSONCodec{}},
+		{MimeCBOR, "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", CBORCodec{}, JSONCodec{}},
+	} {
+		rr := do("/order", tc.ct, tc.accept, tc.enc, small)
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != tc.dec.ContentType() {
+			t.Fatalf("%s -> %s: unexpected response: %d %v %s", tc.ct, tc.accept, rr.Code, rr.Header(), rr.Body.String())
+		}
+		var out Order
+		if err := tc.dec.Decode(rr.Body, &out); err != nil {
+			t.Fatalf("%s -> %s: %v", tc.ct, tc.accept, err)
+		}
+		if !reflect.DeepEqual(out, small) {
+			t.Fatalf("%s -> %s: mismatch:\n%+v\n%+v", tc.ct, tc.accept, out, small)
+		}
+	}
+
+	rr := do("/order", MimeCBOR, MimeCBOR, CBORCodec{}, M{"name": "no id"})
+	var e Error
+	if rr.Code != http.StatusBadRequest || (CBORCodec{}).Decode(rr.Body, &e) != nil || e.Message != "missing id" {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Body.String())
+	}
+
+	if rr = do("/order", MimeJSON, "application/x-gserv-test", JSONCodec{}, small); rr.Body.String() != fmt.Sprintf("test:%v", &small) {
+		t.Fatalf("unexpected response: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = do("/xml", MimeXML, "", XMLCodec{}, small)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != MimeXML || !strings.HasPrefix(rr.Body.String(), "<?xml") {
+		t.Fatalf("unexpected response: %d %v %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+
+	for _, c := range []Codec{JSONCodec{}, MsgpCodec{}, XMLCodec{}, CBORCodec{}, FormCodec{}} {
+		rr = do("/bind", c.ContentType(), "", c, small)
+		dec := c
+		switch c.(type) {
+		case XMLCodec, FormCodec: // decode-only
+			dec = JSONCodec{}
+		}
+		var it Item
+		if err := dec.Decode(rr.Body, &it); rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != dec.ContentType() || it != (Item{"x", 7}) {
+			t.Fatalf("%s: unexpected response: %d %v %s %v", c.ContentType(), rr.Code, rr.Header(), rr.Body.String(), err)
+		}
+	}
+
+	for _, accept := range []string{MimeXML, MimeForm} {
+		if rr = do("/order", MimeJSON, accept, JSONCodec{}, small); rr.Code != http.StatusNotAcceptable {
+			t.Fatalf("%s isn't negotiated by default: %d %v", accept, rr.Code, rr.Header())
+		}
+	}
+
+	srv.GET("/map", func(ctx *Context) Response {
+		ctx.Encode(http.StatusOK, M{"a": 1})
+		return nil
+	})
+	srv.GET("/panic", func(ctx *Context) Response { panic("boom") })
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	for _, p := range []string{"/map", "/panic"} {
+		if rr = get(p, browser); rr.Header().Get("Content-Type") != MimeJSON {
+			t.Fatalf("%s: expected json, got %d %v %s", p, rr.Code, rr.Header(), rr.Body.String())
+		}
+	}
+
+	defer func(list []registeredCodec) {
+		codecs.mux.Lock()
+		codecs.list = list
+		codecs.mux.Unlock()
+	}(slices.Clone(codecs.list))
+	RegisterCodec(MimeXML, XMLCodec{})
+	RegisterCodec(MimeForm, FormCodec{})
+
+	for _, tc := range []struct {
+		accept string
+		dec    Codec
+	}{{MimeXML, XMLCodec{}}, {MimeForm, FormCodec{}}} {
+		rr = do("/order", MimeCBOR, tc.accept, CBORCodec{}, small)
+		var out Order
+		if err := tc.dec.Decode(rr.Body, &out); err != nil || rr.Header().Get("Content-Type") != tc.accept || !reflect.DeepEqual(out, small) {
+			t.Fatalf("%s: unexpected response: %d %v %+v %v", tc.accept, rr.Code, rr.Header(), out, err)
+		}
+	}
+
+	// encoding/xml can't encode maps, the client gets a 500 rather than an empty 200
+	if rr = get("/map", MimeXML); rr.Code != http.StatusInternalServerError || rr.Header().Get("Content-Type") != MimeJSON {
+		t.Fatalf("unexpected response: %d %v %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+}
@@ -3,6 +3,7 @@ package sse
 import (
 	"runtime"
 	"sync"
+	"sync/atomic"
 
 	"go.oneofone.dev/gserv"
 	"go.oneofone.dev/oerrs"
@@ -61,8 +62,14 @@ func NewRouter() *Router {
 }
 
 type Router struct {
-	mux sync.RWMutex
-	mss map[string]*multiStream
+	mux     sync.RWMutex
+	mss     map[string]*multiStream
+	clients atomic.Int64
+}
+
+// Clients returns the number of currently connected clients.
+func (r *Router) Clients() int {
+	return int(r.clients.Load())
 }
 
 func (r *Router) getOrMake(id string) (ms *multiStream) {
@@ -107,8 +114,10 @@ func (r *Router) Handle(id string, bufSize int, ctx *gserv.Context) (_ gserv.Res
 	)
 
 	ms.add(ch)
+	r.clients.Add(1)
 
 	defer r.removeIfEmpty(ms, ch, id)
+	defer r.clients.Add(-1)
 
 	for {
 		select {
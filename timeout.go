@@ -0,0 +1,162 @@
+package gserv
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timeout returns a middleware that gives the rest of the chain d to respond, it can be used on groups or routes, ex:
+//
+//	api := srv.SubGroup("api", "/api", Timeout(5*time.Second))
+//	api.POST("/report", Timeout(time.Minute), report)
+//
+// The deadline is set on ctx.Req.Context(), see Context.Deadline.
+// The response is buffered and RespTimeout is sent if the chain doesn't finish in time,
+// anything it writes after that is discarded and returns http.ErrHandlerTimeout.
+// Since the response is buffered, it shouldn't be used with streaming handlers, ex: SSE.
+// If an outer Timeout has an earlier deadline, it's a no-op.
+func Timeout(d time.Duration) Handler {
+	return func(ctx *Context) Response {
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) <= d {
+			return nil
+		}
+
+		rctx, cancel := context.WithTimeout(ctx.Req.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{h: ctx.Header().Clone()}
+
+		// the chain continues on a copy of ctx, so a late handler never touches ctx, its pooled params
+		// or the request's body once we return, and ctx can be returned to the pool as usual.
+		hctx := new(Context)
+		*hctx = *ctx
+		hctx.ResponseWriter = tw
+		hctx.Req = ctx.Req.WithContext(rctx)
+		hctx.Params = ctx.Params.Copy()
+		hctx.data = maps.Clone(ctx.data)
+		ctx.nextMW, ctx.next = nil, nil
+
+		var tb *timeoutBody
+		if body := hctx.Req.Body; body != nil && body != http.NoBody {
+			tb = &timeoutBody{ReadCloser: body}
+			hctx.Req.Body = tb
+		}
+
+		var (
+			done = make(chan struct{})
+			pv   any
+		)
+
+		go func() {
+			defer func() {
+				pv = recover()
+				close(done)
+			}()
+			hctx.NextMiddleware()
+			hctx.Next()
+		}()
+
+		select {
+		case <-done:
+			if pv != nil {
+				panic(pv)
+			}
+			ctx.data, ctx.reqID, ctx.logger, ctx.panicked = hctx.data, hctx.reqID, hctx.logger, hctx.panicked
+			tw.writeTo(ctx)
+			return nil
+
+		case <-rctx.Done():
+			tw.timeout()
+			if tb != nil {
+				tb.timedOut.Store(true)
+			}
+			if ctx.Req.Context().Err() != nil { // the client is gone
+				return Break
+			}
+			return RespTimeout
+		}
+	}
+}
+
+// Deadline returns the request's deadline, if any, see Timeout.
+func (ctx *Context) Deadline() (deadline time.Time, ok bool) {
+	return ctx.Req.Context().Deadline()
+}
+
+// timeoutWriter buffers the response until the handler is done, or discards it once it times out.
+type timeoutWriter struct {
+	h    http.Header
+	buf  bytes.Buffer
+	code int
+
+	mux      sync.Mutex
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if !tw.timedOut && tw.code == 0 {
+		tw.code = code
+	}
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mux.Lock()
+	defer tw.mux.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) timeout() {
+	tw.mux.Lock()
+	tw.timedOut = true
+	tw.mux.Unlock()
+}
+
+// timeoutBody detaches the request's body from a late handler, since the server closes it once we return.
+type timeoutBody struct {
+	io.ReadCloser
+	timedOut atomic.Bool
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	if b.timedOut.Load() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return b.ReadCloser.Read(p)
+}
+
+func (b *timeoutBody) Close() error {
+	if b.timedOut.Load() {
+		return nil
+	}
+	return b.ReadCloser.Close()
+}
+
+func (tw *timeoutWriter) writeTo(ctx *Context) {
+	h := ctx.Header()
+	clear(h)
+	maps.Copy(h, tw.h)
+
+	if tw.code == 0 {
+		return
+	}
+	ctx.WriteHeader(tw.code)
+	if tw.buf.Len() > 0 {
+		ctx.Write(tw.buf.Bytes())
+	}
+}
@@ -0,0 +1,58 @@
+package gserv
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"go.oneofone.dev/gserv/trace"
+)
+
+// Trace returns a middleware that starts a server span for each request, named after the route pattern,
+// ex: GET /users/:id.
+// The parent is taken from the W3C traceparent and tracestate headers, and the span is attached to ctx.Req.Context(),
+// so ProxyHandler and JSONRequestCtx propagate it.
+func Trace(t *trace.Tracer) Handler {
+	return func(ctx *Context) Response {
+		req := ctx.Req
+		rctx := req.Context()
+		if sc, ok := trace.Extract(req.Header); ok {
+			rctx = trace.ContextWithRemoteParent(rctx, sc)
+		}
+
+		name, route := req.Method, ""
+		if rn := ctx.Route(); rn != nil {
+			route = rn.Path()
+			name += " " + route
+		}
+
+		rctx, span := t.Start(rctx, name, trace.SpanKindServer)
+		ctx.Req = req.WithContext(rctx)
+
+		span.SetAttr("http.request.method", req.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("url.path", req.URL.Path)
+		span.SetAttr("client.address", ctx.ClientIP())
+		if ua := req.UserAgent(); ua != "" {
+			span.SetAttr("user_agent.original", ua)
+		}
+
+		defer func() {
+			if v := recover(); v != nil {
+				span.RecordPanic(v, string(debug.Stack()))
+				span.End()
+				panic(v)
+			}
+
+			code := ctx.Status()
+			span.SetAttr("http.response.status_code", code)
+			if code >= http.StatusInternalServerError && span.StatusCode() == trace.StatusUnset {
+				span.SetStatus(trace.StatusError, http.StatusText(code))
+			}
+			span.End()
+		}()
+
+		ctx.NextMiddleware()
+		ctx.Next()
+		return nil
+	}
+}
@@ -0,0 +1,200 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// OTLPExporter exports spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+type OTLPExporter struct {
+	Endpoint string            // ex: http://localhost:4318/v1/traces
+	Headers  map[string]string // extra headers, ex: authentication
+	Client   *http.Client      // defaults to http.DefaultClient
+}
+
+// NewOTLPExporter returns an exporter that posts to endpoint, ex: http://localhost:4318/v1/traces.
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{Endpoint: endpoint}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	c := e.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("trace: otlp export to %s failed: %s", e.Endpoint, resp.Status)
+	}
+	return nil
+}
+
+// the OTLP/JSON types, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              SpanKind       `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+
+	otlpStatus struct {
+		Code    StatusCode `json:"code,omitempty"`
+		Message string     `json:"message,omitempty"`
+	}
+
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		String *string  `json:"stringValue,omitempty"`
+		Bool   *bool    `json:"boolValue,omitempty"`
+		Int    *string  `json:"intValue,omitempty"` // int64 is encoded as a string
+		Double *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+func otlpRequest(spans []*Span) *otlpTraces {
+	var (
+		out   otlpTraces
+		byRes = map[string]int{}
+	)
+
+	for _, s := range spans {
+		i, ok := byRes[s.Service]
+		if !ok {
+			i = len(out.ResourceSpans)
+			byRes[s.Service] = i
+			out.ResourceSpans = append(out.ResourceSpans, otlpResourceSpans{
+				Resource:   otlpResource{Attributes: otlpAttrs([]Attr{{"service.name", s.Service}})},
+				ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "go.oneofone.dev/gserv"}}},
+			})
+		}
+
+		ss := &out.ResourceSpans[i].ScopeSpans[0]
+		ss.Spans = append(ss.Spans, otlpSpanOf(s))
+	}
+
+	return &out
+}
+
+func otlpSpanOf(s *Span) otlpSpan {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	out := otlpSpan{
+		TraceID:           s.Context.TraceID.String(),
+		SpanID:            s.Context.SpanID.String(),
+		TraceState:        s.Context.State,
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		Attributes:        otlpAttrs(s.Attrs),
+		Status:            otlpStatus{Code: s.Status, Message: s.Message},
+	}
+
+	if s.Parent.IsValid() {
+		out.ParentSpanID = s.Parent.String()
+	}
+
+	for _, e := range s.Events {
+		out.Events = append(out.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(e.Time.UnixNano(), 10),
+			Name:         e.Name,
+			Attributes:   otlpAttrs(e.Attrs),
+		})
+	}
+
+	return out
+}
+
+func otlpAttrs(attrs []Attr) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch x := a.Value.(type) {
+		case string:
+			v.String = &x
+		case bool:
+			v.Bool = &x
+		case int:
+			s := strconv.Itoa(x)
+			v.Int = &s
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.Int = &s
+		case float64:
+			v.Double = &x
+		default:
+			s := fmt.Sprint(x)
+			v.String = &s
+		}
+		out = append(out, otlpKeyValue{a.Key, v})
+	}
+	return out
+}
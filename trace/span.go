@@ -0,0 +1,265 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SpanKind values match the OTLP ones.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+)
+
+// StatusCode values match the OTLP ones.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// Attr is a span or event attribute, Value is a string, bool, int, int64 or float64, anything else is formatted with %v.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// Event is a timed annotation on a span, ex: an exception.
+type Event struct {
+	Name  string
+	Time  time.Time
+	Attrs []Attr
+}
+
+// Span is a single operation in a trace, it's safe for concurrent use until End is called.
+type Span struct {
+	Name    string
+	Kind    SpanKind
+	Service string
+	Context SpanContext
+	Parent  SpanID
+
+	StartTime time.Time
+	EndTime   time.Time
+
+	Attrs   []Attr
+	Events  []Event
+	Status  StatusCode
+	Message string // status message
+
+	mux   sync.Mutex
+	t     *Tracer
+	ended bool
+}
+
+// SetAttr sets (or replaces) an attribute.
+func (s *Span) SetAttr(key string, value any) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i := range s.Attrs {
+		if s.Attrs[i].Key == key {
+			s.Attrs[i].Value = value
+			return
+		}
+	}
+	s.Attrs = append(s.Attrs, Attr{key, value})
+}
+
+// SetStatus sets the span's status.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	s.mux.Lock()
+	s.Status, s.Message = code, msg
+	s.mux.Unlock()
+}
+
+// StatusCode returns the span's status code.
+func (s *Span) StatusCode() StatusCode {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.Status
+}
+
+// AddEvent adds an event to the span.
+func (s *Span) AddEvent(name string, attrs ...Attr) {
+	s.mux.Lock()
+	s.Events = append(s.Events, Event{Name: name, Time: time.Now(), Attrs: attrs})
+	s.mux.Unlock()
+}
+
+// RecordPanic adds an exception event for a recovered panic and sets the status to StatusError.
+func (s *Span) RecordPanic(v any, stack string) {
+	s.AddEvent("exception",
+		Attr{"exception.type", fmt.Sprintf("%T", v)},
+		Attr{"exception.message", fmt.Sprint(v)},
+		Attr{"exception.stacktrace", stack},
+	)
+	s.SetStatus(StatusError, fmt.Sprintf("panic: %v", v))
+}
+
+// End ends the span and queues it for export if it's sampled, calling it more than once is a no-op.
+func (s *Span) End() {
+	s.mux.Lock()
+	if s.ended {
+		s.mux.Unlock()
+		return
+	}
+	s.ended, s.EndTime = true, time.Now()
+	s.mux.Unlock()
+
+	if s.Context.IsSampled() {
+		s.t.enqueue(s)
+	}
+}
+
+// Exporter exports ended spans, ex: OTLPExporter.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer starts spans and exports them in batches.
+type Tracer struct {
+	// OnError is called if an export fails, defaults to ignoring the error.
+	OnError func(err error)
+
+	service string
+	exp     Exporter
+
+	mux           sync.Mutex
+	queue         []*Span
+	exportTimeout time.Duration
+	flushCh       chan struct{}
+	done          chan struct{}
+	wg            sync.WaitGroup
+}
+
+const (
+	batchSize     = 512
+	maxQueueSize  = 4096
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// NewTracer returns a tracer that exports its spans to exp every few seconds, or when enough spans are queued.
+// Shutdown must be called to flush the remaining spans.
+func NewTracer(service string, exp Exporter) *Tracer {
+	t := &Tracer{
+		service: service,
+		exp:     exp,
+		flushCh: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.process()
+	return t
+}
+
+// Start starts a new span, its parent is the span in ctx, or the remote parent set by ContextWithRemoteParent.
+// The returned context holds the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	s := &Span{
+		Name:      name,
+		Kind:      kind,
+		Service:   t.service,
+		StartTime: time.Now(),
+		t:         t,
+	}
+
+	if p := SpanContextFromContext(ctx); p.IsValid() {
+		s.Context = SpanContext{TraceID: p.TraceID, Flags: p.Flags, State: p.State}
+		s.Parent = p.SpanID
+	} else {
+		s.Context = SpanContext{TraceID: newTraceID(), Flags: FlagSampled}
+	}
+	s.Context.SpanID = newSpanID()
+
+	return ContextWithSpan(ctx, s), s
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mux.Lock()
+	if len(t.queue) < maxQueueSize {
+		t.queue = append(t.queue, s)
+	}
+	full := len(t.queue) >= batchSize
+	t.mux.Unlock()
+
+	if full {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) process() {
+	defer t.wg.Done()
+
+	tk := time.NewTicker(flushInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-tk.C:
+		case <-t.flushCh:
+		case <-t.done:
+			return
+		}
+		t.Flush(context.Background())
+	}
+}
+
+// Flush exports all the queued spans, a failed batch doesn't stop the following ones from being exported.
+// The returned error joins the errors of all the failed batches.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.mux.Lock()
+	spans := t.queue
+	t.queue = nil
+	t.mux.Unlock()
+
+	var errs []error
+	for len(spans) > 0 {
+		n := min(len(spans), batchSize)
+		if err := t.export(ctx, spans[:n]); err != nil {
+			if t.OnError != nil {
+				t.OnError(err)
+			}
+			errs = append(errs, err)
+		}
+		spans = spans[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// SetExportTimeout sets the timeout of each exported batch, defaults to 10 seconds.
+func (t *Tracer) SetExportTimeout(d time.Duration) {
+	t.mux.Lock()
+	t.exportTimeout = d
+	t.mux.Unlock()
+}
+
+func (t *Tracer) export(ctx context.Context, spans []*Span) error {
+	t.mux.Lock()
+	timeout := t.exportTimeout
+	t.mux.Unlock()
+	if timeout <= 0 {
+		timeout = exportTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return t.exp.Export(ctx, spans)
+}
+
+// Shutdown stops the background exporter and flushes the remaining spans.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	close(t.done)
+	t.wg.Wait()
+	return t.Flush(ctx)
+}
@@ -0,0 +1,149 @@
+// Package trace implements minimal OpenTelemetry compatible tracing,
+// with W3C trace context propagation and pluggable exporters, see gserv.Trace.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+func newTraceID() (t TraceID) {
+	for !t.IsValid() {
+		binary.BigEndian.PutUint64(t[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(t[8:], rand.Uint64())
+	}
+	return
+}
+
+func newSpanID() (s SpanID) {
+	for !s.IsValid() {
+		binary.BigEndian.PutUint64(s[:], rand.Uint64())
+	}
+	return
+}
+
+// FlagSampled is the sampled bit of SpanContext.Flags.
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span that's propagated across services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	State   string // the raw tracestate header, propagated as is
+}
+
+func (sc SpanContext) IsValid() bool   { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+func (sc SpanContext) IsSampled() bool { return sc.Flags&FlagSampled != 0 }
+
+// Traceparent returns the W3C traceparent header value, ex: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(v string) (sc SpanContext, ok bool) {
+	v = strings.TrimSpace(v)
+	// version-traceid-spanid-flags, future versions may append more fields
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' || (len(v) > 55 && v[55] != '-') {
+		return
+	}
+
+	var ver, flags [1]byte
+	if _, err := hex.Decode(ver[:], []byte(v[:2])); err != nil || ver[0] == 0xff || (ver[0] == 0 && len(v) != 55) {
+		return
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(v[3:35])); err != nil {
+		return
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(v[36:52])); err != nil {
+		return
+	}
+	if _, err := hex.Decode(flags[:], []byte(v[53:55])); err != nil {
+		return
+	}
+
+	// uppercase hex is invalid
+	if strings.ToLower(v[:55]) != v[:55] {
+		return
+	}
+
+	sc.Flags = flags[0]
+	return sc, sc.IsValid()
+}
+
+// Extract returns the span context from the traceparent and tracestate headers.
+func Extract(h http.Header) (sc SpanContext, ok bool) {
+	if sc, ok = ParseTraceparent(h.Get(TraceparentHeader)); ok {
+		sc.State = h.Get(TracestateHeader)
+	}
+	return
+}
+
+// Inject sets the traceparent and tracestate headers from the span (or remote parent) in ctx, if any.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.State != "" {
+		h.Set(TracestateHeader, sc.State)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+type ctxKey uint8
+
+const (
+	spanCtxKey ctxKey = iota
+	remoteCtxKey
+)
+
+// ContextWithSpan returns a copy of ctx holding s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanCtxKey, s)
+}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanCtxKey).(*Span)
+	return s
+}
+
+// ContextWithRemoteParent returns a copy of ctx holding sc, which is used as the parent of spans started with ctx,
+// unless ctx has a local span.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteCtxKey, sc)
+}
+
+// SpanContextFromContext returns the span context of the span in ctx, or the remote parent if there's no span.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.Context
+	}
+	sc, _ := ctx.Value(remoteCtxKey).(SpanContext)
+	return sc
+}
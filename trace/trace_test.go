@@ -0,0 +1,155 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(valid)
+	if !ok || !sc.IsSampled() || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context: %+v %v", sc, ok)
+	}
+	if sc.Traceparent() != valid {
+		t.Fatalf("expected %s, got %s", valid, sc.Traceparent())
+	}
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(v); ok {
+			t.Errorf("%q: expected an invalid traceparent", v)
+		}
+	}
+
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Error("future versions may have extra fields")
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	in := http.Header{}
+	in.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Set(TracestateHeader, "vendor=1")
+
+	sc, ok := Extract(in)
+	if !ok {
+		t.Fatal("expected a span context")
+	}
+
+	tr := NewTracer("svc", nopExporter{})
+	defer tr.Shutdown(context.Background())
+
+	ctx, span := tr.Start(ContextWithRemoteParent(context.Background(), sc), "op", SpanKindServer)
+	if span.Context.TraceID != sc.TraceID || span.Parent != sc.SpanID || span.Context.SpanID == sc.SpanID {
+		t.Fatalf("unexpected span: %+v", span.Context)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get(TraceparentHeader) != span.Context.Traceparent() || out.Get(TracestateHeader) != "vendor=1" {
+		t.Fatalf("unexpected headers: %v", out)
+	}
+}
+
+type nopExporter struct{}
+
+func (nopExporter) Export(context.Context, []*Span) error { return nil }
+
+type funcExporter func(ctx context.Context, spans []*Span) error
+
+func (fn funcExporter) Export(ctx context.Context, spans []*Span) error { return fn(ctx, spans) }
+
+func TestTracerFlush(t *testing.T) {
+	var batches []int
+	tr := NewTracer("svc", funcExporter(func(ctx context.Context, spans []*Span) error {
+		if dl, ok := ctx.Deadline(); !ok || time.Until(dl) < 30*time.Minute {
+			t.Errorf("expected the export timeout's deadline, got %v", dl)
+		}
+		if batches = append(batches, len(spans)); len(batches) == 1 {
+			return errors.New("collector down")
+		}
+		return nil
+	}))
+	defer tr.Shutdown(context.Background())
+	tr.SetExportTimeout(time.Hour)
+
+	var errs int
+	tr.OnError = func(error) { errs++ }
+
+	tr.mux.Lock()
+	for i := 0; i < batchSize*2+1; i++ {
+		tr.queue = append(tr.queue, &Span{})
+	}
+	tr.mux.Unlock()
+
+	if err := tr.Flush(context.Background()); err == nil || err.Error() != "collector down" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if errs != 1 || len(batches) != 3 || batches[2] != 1 {
+		t.Fatalf("expected all batches to be exported: %v (%d errors)", batches, errs)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got otlpTraces
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/traces" || req.Header.Get("Content-Type") != "application/json" || req.Header.Get("X-Key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(req.Body)
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer collector.Close()
+
+	exp := NewOTLPExporter(collector.URL + "/v1/traces")
+	exp.Headers = map[string]string{"X-Key": "secret"}
+
+	tr := NewTracer("svc", exp)
+	ctx, parent := tr.Start(context.Background(), "parent", SpanKindServer)
+	_, child := tr.Start(ctx, "child", SpanKindClient)
+	child.SetAttr("n", 42)
+	child.RecordPanic("boom", "stack")
+	child.End()
+	parent.End()
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans[0].Spans) != 2 {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+
+	rs := got.ResourceSpans[0]
+	if v := rs.Resource.Attributes[0]; v.Key != "service.name" || *v.Value.String != "svc" {
+		t.Fatalf("unexpected resource: %+v", rs.Resource)
+	}
+
+	cs := rs.ScopeSpans[0].Spans[0]
+	if cs.Name != "child" || cs.ParentSpanID != parent.Context.SpanID.String() || cs.TraceID != parent.Context.TraceID.String() ||
+		cs.Kind != SpanKindClient || cs.Status.Code != StatusError || len(cs.Events) != 1 || *cs.Attributes[0].Value.Int != "42" {
+		t.Fatalf("unexpected span: %+v", cs)
+	}
+
+	exp.Endpoint = collector.URL + "/nope"
+	if err := exp.Export(context.Background(), []*Span{parent}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
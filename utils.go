@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"time"
 
@@ -29,6 +31,19 @@ func HTTPHandlerFunc(h http.HandlerFunc) Handler {
 	}
 }
 
+// funcNames returns the names of the handlers, ex: go.oneofone.dev/gserv.LogRequests.func1.
+func funcNames(hs []Handler) []string {
+	out := make([]string, 0, len(hs))
+	for _, h := range hs {
+		name := "???"
+		if fn := runtime.FuncForPC(reflect.ValueOf(h).Pointer()); fn != nil {
+			name = fn.Name()
+		}
+		out = append(out, name)
+	}
+	return out
+}
+
 // StaticDirStd is a QoL wrapper for http.FileServer(http.Dir(dir)).
 func StaticDirStd(prefix, dir string, allowListing bool) Handler {
 	var fs http.FileSystem
@@ -0,0 +1,323 @@
+package gserv
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator can be implemented by request types to add custom checks, it's called by Validate after the tag rules.
+// Returned Errors without a Field get the value's path, and MultiErrors are merged.
+type Validator interface {
+	Validate() error
+}
+
+// Validate checks v using its fields' `validate` tags, ex:
+//
+//	type CreateUser struct {
+//		Name  string   `json:"name" validate:"required,min=3,max=64"`
+//		Email string   `json:"email" validate:"required,email"`
+//		Role  string   `json:"role" validate:"omitempty,oneof=admin user"`
+//		Tags  []string `json:"tags" validate:"max=10"`
+//	}
+//
+// Rules:
+//
+//	required       the value isn't the zero value, or an empty slice / map
+//	omitempty      skip the rest of the rules if the value is zero
+//	min=N, max=N   the min / max number for numbers, or length for strings (in runes), slices and maps
+//	len=N          the exact length of strings, slices and maps
+//	email, url     the string is a valid email address / absolute url
+//	oneof=a b c    the value is one of the space separated values
+//
+// Nested structs, pointers, slices and maps are checked recursively, and any value implementing Validator is called.
+// Fields are named after their json tag, then their BindRequest tag, then their Go name.
+// Unknown or malformed rules, ex: go-playground/validator's `gte=1` or `dive`, and rules that don't apply
+// to the field's type are ignored, so tags shared with another validator don't break requests.
+// It returns a MultiError of Errors with their Field set to the field's path, ex: `items[0].name`, or nil.
+func Validate(v any) error {
+	var me MultiError
+	validateValue(reflect.ValueOf(v), "", &me)
+	if len(me) > 0 {
+		return me
+	}
+	return nil
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+func validateValue(v reflect.Value, path string, me *MultiError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() { // ex: Validate(nil)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			break
+		}
+		for _, f := range validateFieldsOf(v.Type()) {
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil { // nil embedded pointer
+				continue
+			}
+			f.check(fv, fieldPath(path, f.name), me)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", me)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), path+"["+fmt.Sprint(iter.Key())+"]", me)
+		}
+	}
+
+	callValidator(v, path, me)
+}
+
+func callValidator(v reflect.Value, path string, me *MultiError) {
+	var vv Validator
+	switch {
+	case v.Type().Implements(validatorType):
+		vv = v.Interface().(Validator)
+	case v.CanAddr() && v.Addr().Type().Implements(validatorType):
+		vv = v.Addr().Interface().(Validator)
+	case reflect.PointerTo(v.Type()).Implements(validatorType):
+		pv := reflect.New(v.Type())
+		pv.Elem().Set(v)
+		vv = pv.Interface().(Validator)
+	default:
+		return
+	}
+
+	err := vv.Validate()
+	if err == nil {
+		return
+	}
+
+	errs, ok := err.(MultiError)
+	if !ok {
+		errs = MultiError{err}
+	}
+
+	for _, err := range errs {
+		var e Error
+		switch err := err.(type) {
+		case Error:
+			e = err
+		case *Error:
+			e = *err
+		default:
+			e = Error{Message: err.Error()}
+		}
+		if e.Code == 0 {
+			e.Code = http.StatusBadRequest
+		}
+		switch {
+		case e.Field == "":
+			e.Field = path
+		case path != "":
+			e.Field = fieldPath(path, e.Field)
+		}
+		me.Push(e)
+	}
+}
+
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+type validateField struct {
+	index     []int
+	name      string
+	required  bool
+	omitempty bool
+	rules     []validateRule
+}
+
+type validateRule struct {
+	name string
+	arg  string
+	n    float64
+	args []string
+}
+
+var validateCache sync.Map // map[reflect.Type][]validateField
+
+func validateFieldsOf(t reflect.Type) []validateField {
+	if v, ok := validateCache.Load(t); ok {
+		return v.([]validateField)
+	}
+
+	var out []validateField
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() || (sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+
+		tag := sf.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+
+		f := validateField{index: sf.Index, name: fieldName(sf)}
+		for _, r := range strings.Split(tag, ",") {
+			if r = strings.TrimSpace(r); r == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(r, "=")
+			switch name {
+			case "required":
+				f.required = true
+			case "omitempty":
+				f.omitempty = true
+			case "min", "max", "len":
+				n, err := strconv.ParseFloat(arg, 64)
+				if err != nil { // ex: go-playground/validator's `max=N` on time.Time fields
+					continue
+				}
+				f.rules = append(f.rules, validateRule{name: name, arg: arg, n: n})
+			case "email", "url":
+				f.rules = append(f.rules, validateRule{name: name})
+			case "oneof":
+				f.rules = append(f.rules, validateRule{name: name, arg: arg, args: strings.Fields(arg)})
+			}
+		}
+		out = append(out, f)
+	}
+
+	validateCache.Store(t, out)
+	return out
+}
+
+func fieldName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	for _, src := range bindSources {
+		if name := sf.Tag.Get(src); name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+func (f *validateField) check(v reflect.Value, path string, me *MultiError) {
+	fail := func(format string, args ...any) {
+		me.Push(Error{Code: http.StatusBadRequest, Field: path, Message: path + " " + fmt.Sprintf(format, args...)})
+	}
+
+	if isEmptyValue(v) {
+		if f.required {
+			fail("is required")
+			return
+		}
+		if f.omitempty {
+			return
+		}
+	}
+
+	rv := v
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	for _, r := range f.rules {
+		if (r.name == "email" || r.name == "url") && rv.Kind() != reflect.String {
+			continue
+		}
+
+		switch r.name {
+		case "min", "max", "len":
+			n, unit, ok := measure(rv)
+			if !ok {
+				continue
+			}
+			switch {
+			case r.name == "min" && n < r.n:
+				fail("must be at least %s%s", r.arg, unit)
+			case r.name == "max" && n > r.n:
+				fail("must be at most %s%s", r.arg, unit)
+			case r.name == "len" && n != r.n:
+				fail("must be exactly %s%s", r.arg, unit)
+			}
+		case "email":
+			if s := rv.String(); !isEmail(s) {
+				fail("must be a valid email address")
+			}
+		case "url":
+			if u, err := url.Parse(rv.String()); err != nil || u.Scheme == "" || u.Host == "" {
+				fail("must be a valid url")
+			}
+		case "oneof":
+			if s := valueString(rv); !slices.Contains(r.args, s) {
+				fail("must be one of [%s]", r.arg)
+			}
+		}
+	}
+
+	validateValue(v, path, me)
+}
+
+// measure returns the number to compare with min, max and len.
+func measure(v reflect.Value) (n float64, unit string, ok bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+func isEmail(s string) bool {
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s && strings.Contains(s[strings.LastIndexByte(s, '@'):], ".")
+}
+
+func valueString(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}